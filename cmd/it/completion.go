@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/satyaki-up/issuetracker/internal/db"
+	"github.com/satyaki-up/issuetracker/internal/issues"
+)
+
+// The shell scripts below hand the words typed so far to the hidden
+// `it __complete` command, so every rule lives here. It prints one candidate
+// per line as "value<TAB>description"; when it prints nothing the shells fall
+// back to file names.
+
+const bashCompletion = `# bash completion for it; load with: source <(it completion bash)
+_it_complete() {
+    local IFS=$'\n'
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    COMPREPLY=($("${COMP_WORDS[0]}" __complete "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null | cut -f1))
+}
+complete -o default -F _it_complete it
+`
+
+const zshCompletion = `#compdef it
+# zsh completion for it; load with: source <(it completion zsh)
+_it() {
+    local -a lines candidates
+    local line value
+    lines=("${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT-1]}" "${words[CURRENT]}" 2>/dev/null)}")
+    for line in $lines; do
+        [[ -z $line ]] && continue
+        value=${line%%$'\t'*}
+        value=${value//:/\\:}
+        if [[ $line == *$'\t'* ]]; then
+            candidates+=("$value:${line#*$'\t'}")
+        else
+            candidates+=("$value")
+        fi
+    done
+    if (( ${#candidates} == 0 )); then
+        _files
+        return
+    fi
+    _describe -t values 'it' candidates
+}
+compdef _it it
+`
+
+const fishCompletion = `# fish completion for it; load with: it completion fish | source
+function __it_complete
+    set -l tokens (commandline -opc)
+    $tokens[1] __complete $tokens[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c it -f -a '(__it_complete)'
+complete -c it -l db -r -F
+complete -c it -l body-file -r -F
+complete -c it -l from -r -F
+complete -c it -l dir -r -F
+`
+
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+func handleCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "error: completion requires a shell: bash|zsh|fish")
+		return 2
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error: unsupported shell %q (use bash|zsh|fish)\n", args[0])
+		return 2
+	}
+	fmt.Print(script)
+	return 0
+}
+
+// handleComplete serves the completion scripts: args are the words after
+// "it" with the word under the cursor last. It never reports errors, since
+// anything on the terminal would corrupt the command line being edited.
+func handleComplete(ctx context.Context, args []string, defaultDBPath string) int {
+	if len(args) == 0 {
+		return 0
+	}
+	words, cur := args[:len(args)-1], args[len(args)-1]
+	src := &dbCompletionSource{ctx: ctx, path: completionDBPath(words, defaultDBPath)}
+	defer src.close()
+	for _, c := range complete(words, cur, src) {
+		if c.desc != "" {
+			fmt.Printf("%s\t%s\n", c.value, c.desc)
+		} else {
+			fmt.Println(c.value)
+		}
+	}
+	return 0
+}
+
+type candidate struct {
+	value string
+	desc  string
+}
+
+// completionSource supplies candidates that live in the database.
+type completionSource interface {
+	issueIDs() []candidate
+	viewNames() []candidate
+}
+
+var commandHelp = []candidate{
+	{"create", "create an issue"},
+	{"show", "show one issue"},
+	{"list", "list issues"},
+	{"search", "full-text search"},
+	{"view", "saved list views"},
+	{"ready", "tasks ready to start"},
+	{"state", "change state"},
+	{"edit", "edit title or body"},
+	{"assign", "set or clear the assignee"},
+	{"claim", "assign to yourself and start"},
+	{"parent", "change parent"},
+	{"blocked-by", "set dependencies"},
+	{"tree", "show the hierarchy"},
+	{"archive", "archive issues"},
+	{"delete", "delete issues"},
+	{"label", "add or remove labels"},
+	{"comment", "add or list comments"},
+	{"history", "show change history"},
+	{"doctor", "check and repair invariants"},
+	{"db", "migrations, backup and restore"},
+	{"schema", "print the JSON Schema"},
+	{"completion", "print a shell completion script"},
+	{"help", "show usage"},
+}
+
+var subcommandHelp = map[string][]candidate{
+	"view":    {{"save", "save a list query"}, {"run", "run a saved view"}, {"list", "list saved views"}, {"delete", "delete a saved view"}},
+	"comment": {{"add", "add a comment"}, {"list", "list comments"}},
+	"label":   {{"add", "add labels"}, {"remove", "remove labels"}},
+	"db":      {{"migrate", "apply pending migrations"}, {"status", "show applied migrations"}, {"down", "roll back migrations"}, {"backup", "copy the database safely"}, {"restore", "replace the database from a backup"}, {"snapshot", "write a rotating timestamped backup"}},
+}
+
+// listFlagNames are the filter flags shared by list and view save.
+func listFlagNames() []string {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	addListFlags(fs)
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	return names
+}
+
+// commandFlags lists the flags of every command, keyed like the handlers'
+// flag sets ("list", "view save", ...). TestCommandFlagsMatchHandlers checks
+// each entry against the handler's FlagSet.
+var commandFlags = map[string][]string{
+	"create":       {"project", "c", "title", "body", "p", "blocked-by", "json"},
+	"show":         {"id", "comments", "json"},
+	"list":         append(listFlagNames(), "limit", "cursor", "json"),
+	"search":       {"project", "state", "include-archived", "limit", "json"},
+	"view save":    append(listFlagNames(), "json"),
+	"view run":     {"limit", "cursor", "json"},
+	"view list":    {"json"},
+	"view delete":  {"json"},
+	"ready":        {"project", "limit", "json"},
+	"state":        {"id", "to", "blocked-reason", "expected-version", "json"},
+	"edit":         {"id", "title", "body", "body-file", "expected-version", "json"},
+	"assign":       {"id", "to", "clear", "expected-version", "json"},
+	"claim":        {"id", "as", "json"},
+	"parent":       {"id", "p", "clear", "expected-version", "json"},
+	"blocked-by":   {"id", "set", "clear", "expected-version", "json"},
+	"tree":         {"project", "include-archived", "json"},
+	"archive":      {"id", "cascade", "expected-version", "json"},
+	"delete":       {"id", "cascade", "expected-version", "json"},
+	"label add":    {"id", "json"},
+	"label remove": {"id", "json"},
+	"comment add":  {"id", "text", "json"},
+	"comment list": {"id", "json"},
+	"history":      {"id", "json"},
+	"doctor":       {"fix", "json"},
+	"db migrate":   {"to", "allow-destructive", "json"},
+	"db status":    {"json"},
+	"db down":      {"to", "json"},
+	"db backup":    {"to", "json"},
+	"db restore":   {"from", "json"},
+	"db snapshot":  {"dir", "keep", "json"},
+}
+
+var globalFlags = []string{"db", "actor", "format"}
+
+// boolFlags take no value, so the word after them is not theirs.
+var boolFlags = map[string]bool{
+	"json": true, "comments": true, "include-archived": true, "reverse": true, "clear": true, "cascade": true, "allow-destructive": true, "fix": true,
+}
+
+// idFlags take issue IDs; csvFlags marks those taking comma-separated lists.
+var (
+	idFlags  = map[string]bool{"id": true, "p": true, "blocked-by": true, "set": true, "parent": true, "under": true}
+	csvFlags = map[string]bool{"blocked-by": true, "set": true, "state": true, "category": true}
+)
+
+var stateCandidates = []candidate{
+	{string(issues.StateTodo), ""},
+	{string(issues.StateInProgress), ""},
+	{string(issues.StateBlocked), ""},
+	{string(issues.StateDone), ""},
+	{string(issues.StateCanceled), ""},
+}
+
+var categoryShortcuts = []candidate{{"t", "task"}, {"w", "workstream"}, {"p", "project"}}
+
+// complete returns the candidates for cur given the words before it.
+func complete(words []string, cur string, src completionSource) []candidate {
+	i := 0
+	for i < len(words) && strings.HasPrefix(words[i], "-") {
+		name, _, hasValue := strings.Cut(flagName(words[i]), "=")
+		i++
+		if !hasValue && !boolFlags[name] {
+			i++
+		}
+	}
+	if i > len(words) {
+		// cur is the value of the last global flag.
+		return flagValues("", flagName(words[len(words)-1]), cur, src)
+	}
+	if i == len(words) {
+		if strings.HasPrefix(cur, "-") {
+			return flagCandidates(globalFlags, nil, cur)
+		}
+		return filterPrefix(commandHelp, cur)
+	}
+
+	cmd, rest := words[i], words[i+1:]
+	switch cmd {
+	case "completion":
+		if len(rest) == 0 {
+			return filterPrefix([]candidate{{"bash", ""}, {"zsh", ""}, {"fish", ""}}, cur)
+		}
+		return nil
+	case "view", "comment", "label", "db":
+		if len(rest) == 0 {
+			return filterPrefix(subcommandHelp[cmd], cur)
+		}
+		cmd, rest = cmd+" "+rest[0], rest[1:]
+	}
+	flags, ok := commandFlags[cmd]
+	if !ok {
+		return nil
+	}
+
+	if len(rest) > 0 {
+		if prev := flagName(rest[len(rest)-1]); strings.HasPrefix(rest[len(rest)-1], "-") && !strings.Contains(prev, "=") && !boolFlags[prev] {
+			return flagValues(cmd, prev, cur, src)
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		return flagCandidates(flags, rest, cur)
+	}
+	if (cmd == "view run" || cmd == "view delete") && len(positionals(rest)) == 0 {
+		return filterPrefix(src.viewNames(), cur)
+	}
+	return nil
+}
+
+func flagName(word string) string {
+	return strings.TrimLeft(word, "-")
+}
+
+// positionals drops flags and their values from words.
+func positionals(words []string) []string {
+	var out []string
+	for i := 0; i < len(words); i++ {
+		if !strings.HasPrefix(words[i], "-") {
+			out = append(out, words[i])
+			continue
+		}
+		name := flagName(words[i])
+		if !strings.Contains(name, "=") && !boolFlags[name] {
+			i++
+		}
+	}
+	return out
+}
+
+// flagCandidates spells one-letter flags with one dash and the rest with
+// two, the way the manual does, and skips flags already given.
+func flagCandidates(flags, used []string, cur string) []candidate {
+	seen := make(map[string]bool)
+	for _, w := range used {
+		if strings.HasPrefix(w, "-") {
+			name, _, _ := strings.Cut(flagName(w), "=")
+			seen[name] = true
+		}
+	}
+	var out []candidate
+	for _, name := range flags {
+		if seen[name] {
+			continue
+		}
+		spelled := "--" + name
+		if len(name) == 1 {
+			spelled = "-" + name
+		}
+		out = append(out, candidate{value: spelled})
+	}
+	return filterPrefix(out, cur)
+}
+
+func flagValues(cmd, name, cur string, src completionSource) []candidate {
+	var values []candidate
+	switch {
+	case idFlags[name]:
+		values = src.issueIDs()
+	case name == "state", name == "to" && cmd == "state":
+		values = stateCandidates
+	case name == "c":
+		values = categoryShortcuts
+	case name == "category":
+		values = []candidate{{"task", ""}, {"workstream", ""}, {"project", ""}, {"t", ""}, {"w", ""}, {"p", ""}}
+	case name == "sort":
+		values = []candidate{{"created", ""}, {"updated", ""}, {"closed", ""}, {"id", ""}, {"title", ""}, {"state", ""}}
+	case name == "has-unresolved-deps":
+		values = []candidate{{"true", ""}, {"false", ""}}
+	case name == "format":
+		values = []candidate{{"table", ""}, {"csv", ""}, {"yaml", ""}, {"ndjson", ""}, {"json", ""}}
+	default:
+		return nil
+	}
+	if !csvFlags[name] {
+		return filterPrefix(values, cur)
+	}
+
+	// Complete the last entry of a comma-separated list, skipping entries
+	// already in it.
+	head, tail := "", cur
+	if idx := strings.LastIndex(cur, ","); idx >= 0 {
+		head, tail = cur[:idx+1], cur[idx+1:]
+	}
+	given := make(map[string]bool)
+	for _, v := range strings.Split(head, ",") {
+		given[v] = true
+	}
+	var out []candidate
+	for _, c := range filterPrefix(values, tail) {
+		if !given[c.value] {
+			out = append(out, candidate{value: head + c.value, desc: c.desc})
+		}
+	}
+	return out
+}
+
+func filterPrefix(candidates []candidate, prefix string) []candidate {
+	var out []candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(c.value, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// completionDBPath honors a --db among the global flags being completed.
+func completionDBPath(words []string, defaultPath string) string {
+	path := defaultPath
+	for i := 0; i < len(words) && strings.HasPrefix(words[i], "-"); i++ {
+		name, value, hasValue := strings.Cut(flagName(words[i]), "=")
+		if !hasValue && !boolFlags[name] && i+1 < len(words) {
+			i++
+			value = words[i]
+		}
+		if name == "db" && value != "" {
+			path = value
+		}
+	}
+	return path
+}
+
+// dbCompletionSource opens the database on first use, and only if it
+// already exists: pressing tab must not create or migrate one.
+type dbCompletionSource struct {
+	ctx      context.Context
+	path     string
+	database *sql.DB
+	svc      *issues.Service
+}
+
+func (s *dbCompletionSource) service() *issues.Service {
+	if s.svc != nil {
+		return s.svc
+	}
+	if _, err := os.Stat(s.path); err != nil {
+		return nil
+	}
+	// Only read a database that is already fully migrated.
+	database, err := db.Connect(s.ctx, s.path)
+	if err != nil {
+		return nil
+	}
+	if v, err := db.SchemaVersion(s.ctx, database); err != nil || v != db.LatestVersion() {
+		database.Close()
+		return nil
+	}
+	s.database = database
+	s.svc = issues.NewService(database)
+	return s.svc
+}
+
+func (s *dbCompletionSource) close() {
+	if s.database != nil {
+		s.database.Close()
+	}
+}
+
+func (s *dbCompletionSource) issueIDs() []candidate {
+	svc := s.service()
+	if svc == nil {
+		return nil
+	}
+	list, _, err := svc.ListIssues(s.ctx, issues.ListFilter{Sort: issues.SortID})
+	if err != nil {
+		return nil
+	}
+	out := make([]candidate, 0, len(list))
+	for _, is := range list {
+		out = append(out, candidate{value: is.ID, desc: completionDesc(is.Title)})
+	}
+	return out
+}
+
+func (s *dbCompletionSource) viewNames() []candidate {
+	svc := s.service()
+	if svc == nil {
+		return nil
+	}
+	views, err := svc.ListViews(s.ctx)
+	if err != nil {
+		return nil
+	}
+	out := make([]candidate, 0, len(views))
+	for _, v := range views {
+		out = append(out, candidate{value: v.Name, desc: completionDesc(v.Query)})
+	}
+	return out
+}
+
+// completionDesc keeps descriptions to one short line.
+func completionDesc(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return truncate(s, 60)
+}
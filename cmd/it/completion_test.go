@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type fakeCompletionSource struct{}
+
+func (fakeCompletionSource) issueIDs() []candidate {
+	return []candidate{{"cat-1", "Platform"}, {"cat-2", "Backend"}, {"dog-1", "Other"}}
+}
+
+func (fakeCompletionSource) viewNames() []candidate {
+	return []candidate{{"mine", ""}, {"stale", ""}}
+}
+
+func TestComplete(t *testing.T) {
+	cases := []struct {
+		words []string
+		cur   string
+		want  []string
+	}{
+		{nil, "cl", []string{"claim"}},
+		{nil, "--f", []string{"--format"}},
+		{[]string{"--db", "x.db"}, "tr", []string{"tree"}},
+		{[]string{"--format"}, "n", []string{"ndjson"}},
+		{[]string{"show"}, "--c", []string{"--comments"}},
+		{[]string{"show", "--id"}, "cat", []string{"cat-1", "cat-2"}},
+		{[]string{"create", "-c"}, "", []string{"t", "w", "p"}},
+		{[]string{"create", "-p"}, "d", []string{"dog-1"}},
+		{[]string{"create", "--blocked-by"}, "cat-1,c", []string{"cat-1,cat-2"}},
+		{[]string{"state", "--to"}, "in", []string{"in_progress"}},
+		{[]string{"assign", "--to"}, "", nil},
+		{[]string{"list", "--state"}, "todo,", []string{"todo,in_progress", "todo,blocked", "todo,done", "todo,canceled"}},
+		{[]string{"parent", "--id", "cat-2"}, "-", []string{"-p", "--clear", "--expected-version", "--json"}},
+		{[]string{"view"}, "r", []string{"run"}},
+		{[]string{"view", "run"}, "s", []string{"stale"}},
+		{[]string{"view", "run", "mine"}, "", nil},
+		{[]string{"label", "add", "--json"}, "--", []string{"--id"}},
+		{[]string{"completion"}, "z", []string{"zsh"}},
+		{[]string{"bogus"}, "", nil},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, cand := range complete(c.words, c.cur, fakeCompletionSource{}) {
+			got = append(got, cand.value)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("complete(%q, %q) = %q, want %q", c.words, c.cur, got, c.want)
+		}
+	}
+}
+
+func TestCompletionDBPath(t *testing.T) {
+	if got := completionDBPath([]string{"--actor", "a", "--db", "x.db", "show"}, "default.db"); got != "x.db" {
+		t.Fatalf("completionDBPath = %q", got)
+	}
+	if got := completionDBPath([]string{"-db=y.db", "list"}, "default.db"); got != "y.db" {
+		t.Fatalf("completionDBPath = %q", got)
+	}
+	if got := completionDBPath([]string{"list", "--db", "z.db"}, "default.db"); got != "default.db" {
+		t.Fatalf("completionDBPath = %q", got)
+	}
+}
+
+// TestCommandFlagsMatchHandlers runs every command with -h and compares the
+// flags its FlagSet prints with commandFlags.
+func TestCommandFlagsMatchHandlers(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "issues.db")
+	flagRe := regexp.MustCompile(`(?m)^  -(\S+)`)
+	for name, want := range commandFlags {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := append([]string{"it", "--db", dbPath}, strings.Fields(name)...)
+		if strings.HasPrefix(name, "view ") && name != "view list" {
+			args = append(args, "mine") // the view name comes before the flags
+		}
+		stderr, osArgs := os.Stderr, os.Args
+		os.Stderr, os.Args = w, append(args, "-h")
+		run()
+		os.Stderr, os.Args = stderr, osArgs
+		w.Close()
+		usage, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(usage), "Usage of "+name+":") {
+			t.Errorf("%s -h: expected the %q flag set's usage, got %q", name, name, usage)
+			continue
+		}
+		var got []string
+		for _, m := range flagRe.FindAllStringSubmatch(string(usage), -1) {
+			got = append(got, m[1])
+		}
+		want = slices.Sorted(slices.Values(want))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("commandFlags[%q] = %q, but the handler defines %q", name, want, got)
+		}
+	}
+}
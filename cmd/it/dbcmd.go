@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/satyaki-up/issuetracker/internal/db"
+	"github.com/satyaki-up/issuetracker/internal/issues"
+)
+
+// openDatabase opens the database for a regular command, applying pending
+// migrations without destructive steps and noting any changes to legacy
+// tables on stderr.
+func openDatabase(ctx context.Context, path string) (*sql.DB, error) {
+	database, err := db.Connect(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	report, err := db.MigrateTo(ctx, database, db.LatestVersion(), db.MigrateOptions{})
+	printMigrationNotes(report)
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+func printMigrationNotes(report *db.MigrationReport) {
+	if report.Backup != "" {
+		fmt.Fprintf(os.Stderr, "note: backed up database to %s before changing the schema\n", report.Backup)
+	}
+	for _, change := range report.Changes {
+		fmt.Fprintf(os.Stderr, "note: %s\n", change)
+	}
+}
+
+// handleDB runs the database maintenance commands. They connect without
+// migrating so status, down and backup see the database as it is.
+func handleDB(ctx context.Context, dbPath string, args []string) int {
+	if len(args) == 0 {
+		return usageError(false, "db requires a subcommand: migrate|status|down|backup|restore|snapshot")
+	}
+	var handler func(context.Context, string, []string) int
+	switch args[0] {
+	case "migrate":
+		handler = handleDBMigrate
+	case "status":
+		handler = handleDBStatus
+	case "down":
+		handler = handleDBDown
+	case "backup":
+		handler = handleDBBackup
+	case "restore":
+		handler = handleDBRestore
+	case "snapshot":
+		handler = handleDBSnapshot
+	default:
+		return usageError(jsonRequested(args), "unknown db subcommand %q (use migrate|status|down|backup|restore|snapshot)", args[0])
+	}
+	return handler(ctx, dbPath, args[1:])
+}
+
+// dbError reports an unreachable target or an unusable backup file as
+// invalid input, and a database in use by another process as a conflict.
+func dbError(err error) error {
+	if errors.Is(err, db.ErrBadTarget) || errors.Is(err, db.ErrIntegrity) || errors.Is(err, db.ErrSchemaTooNew) {
+		return fmt.Errorf("%w: %v", issues.ErrInvalidInput, err)
+	}
+	if errors.Is(err, db.ErrInUse) {
+		return fmt.Errorf("%w: %v", issues.ErrConflict, err)
+	}
+	return err
+}
+
+// connectExisting connects to the database at path without creating it.
+func connectExisting(ctx context.Context, path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("%w: database %s does not exist", issues.ErrNotFound, path)
+	}
+	return db.Connect(ctx, path)
+}
+
+// migrationResult is the JSON shape of db migrate and db down.
+type migrationResult struct {
+	Version    int      `json:"version"`
+	Migrations []string `json:"migrations"`
+	Backup     string   `json:"backup,omitempty"`
+	Changes    []string `json:"changes,omitempty"`
+}
+
+func handleDBMigrate(ctx context.Context, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("db migrate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	to := fs.Int("to", db.LatestVersion(), "target schema version")
+	allowDestructive := fs.Bool("allow-destructive", false, "drop legacy tables and unknown issues columns (a backup is taken first)")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	database, err := db.Connect(ctx, dbPath)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	defer database.Close()
+
+	report, err := db.MigrateTo(ctx, database, *to, db.MigrateOptions{AllowDestructive: *allowDestructive})
+	if !*jsonOut {
+		printMigrationNotes(report)
+	}
+	if err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	return printMigrationResult(ctx, database, report.Applied, "applied", report, *jsonOut)
+}
+
+func handleDBDown(ctx context.Context, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("db down", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	to := fs.Int("to", -1, "target schema version (default: one step back)")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	database, err := connectExisting(ctx, dbPath)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	defer database.Close()
+
+	target := *to
+	if target < 0 {
+		current, err := db.SchemaVersion(ctx, database)
+		if err != nil {
+			return renderError(err, *jsonOut)
+		}
+		target = max(current-1, 0)
+	}
+	report, err := db.Rollback(ctx, database, target)
+	if !*jsonOut {
+		printMigrationNotes(report)
+	}
+	if err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	return printMigrationResult(ctx, database, report.Reverted, "rolled back", report, *jsonOut)
+}
+
+func printMigrationResult(ctx context.Context, database *sql.DB, done []db.Migration, verb string, report *db.MigrationReport, jsonOut bool) int {
+	version, err := db.SchemaVersion(ctx, database)
+	if err != nil {
+		return renderError(err, jsonOut)
+	}
+	if jsonOut {
+		res := migrationResult{Version: version, Migrations: make([]string, 0, len(done))}
+		for _, m := range done {
+			res.Migrations = append(res.Migrations, m.String())
+		}
+		if report != nil {
+			res.Backup = report.Backup
+			res.Changes = report.Changes
+		}
+		printJSON(res)
+		return 0
+	}
+	for _, m := range done {
+		fmt.Printf("%s %s\n", verb, m)
+	}
+	fmt.Printf("schema version %d of %d\n", version, db.LatestVersion())
+	return 0
+}
+
+func handleDBStatus(ctx context.Context, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("db status", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	database, err := connectExisting(ctx, dbPath)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	defer database.Close()
+
+	st, err := db.Status(ctx, database)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(st)
+		return 0
+	}
+	fmt.Printf("schema version %d of %d\n", st.Version, st.Latest)
+	for _, m := range st.Migrations {
+		state := "pending"
+		if m.Applied {
+			state = "applied"
+			if m.AppliedAt != nil {
+				state += " " + m.AppliedAt.Format(time.RFC3339)
+			}
+		}
+		note := ""
+		if !m.Reversible {
+			note = "  (irreversible)"
+		}
+		fmt.Printf("%04d  %-20s  %s%s\n", m.Version, m.Name, state, note)
+	}
+	return 0
+}
+
+// backupResult is the JSON shape of db backup, restore and snapshot; path
+// is the file written.
+type backupResult struct {
+	Path     string   `json:"path"`
+	From     string   `json:"from,omitempty"`
+	Previous string   `json:"previous,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+func handleDBBackup(ctx context.Context, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("db backup", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	to := fs.String("to", "", "backup file to write (must not exist)")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if strings.TrimSpace(*to) == "" {
+		return renderError(fmt.Errorf("%w: --to is required", issues.ErrInvalidInput), *jsonOut)
+	}
+	if _, err := os.Stat(*to); err == nil {
+		return renderError(fmt.Errorf("%w: %s already exists", issues.ErrInvalidInput, *to), *jsonOut)
+	}
+
+	database, err := connectExisting(ctx, dbPath)
+	if err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	defer database.Close()
+
+	if err := db.Backup(ctx, database, *to); err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(backupResult{Path: *to})
+		return 0
+	}
+	fmt.Printf("backed up %s to %s\n", dbPath, *to)
+	return 0
+}
+
+func handleDBRestore(ctx context.Context, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("db restore", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	from := fs.String("from", "", "backup or snapshot file to restore")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if strings.TrimSpace(*from) == "" {
+		return renderError(fmt.Errorf("%w: --from is required", issues.ErrInvalidInput), *jsonOut)
+	}
+	if _, err := os.Stat(*from); err != nil {
+		return renderError(fmt.Errorf("%w: backup %s does not exist", issues.ErrNotFound, *from), *jsonOut)
+	}
+
+	previous, err := db.Restore(ctx, *from, dbPath)
+	if err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(backupResult{Path: dbPath, From: *from, Previous: previous})
+		return 0
+	}
+	fmt.Printf("restored %s from %s\n", dbPath, *from)
+	if previous != "" {
+		fmt.Printf("previous database kept as %s\n", previous)
+	}
+	return 0
+}
+
+func handleDBSnapshot(ctx context.Context, dbPath string, args []string) int {
+	fs := flag.NewFlagSet("db snapshot", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dir := fs.String("dir", "", "snapshot directory (default: snapshots/ next to the database)")
+	keep := fs.Int("keep", 10, "number of snapshots to keep (0 = all)")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *keep < 0 {
+		return renderError(fmt.Errorf("%w: --keep must be >= 0", issues.ErrInvalidInput), *jsonOut)
+	}
+	if strings.TrimSpace(*dir) == "" {
+		*dir = filepath.Join(filepath.Dir(dbPath), "snapshots")
+	}
+
+	database, err := connectExisting(ctx, dbPath)
+	if err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	defer database.Close()
+
+	path, removed, err := db.Snapshot(ctx, database, *dir, *keep)
+	if err != nil {
+		return renderError(dbError(err), *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(backupResult{Path: path, Removed: removed})
+		return 0
+	}
+	fmt.Printf("wrote snapshot %s\n", path)
+	for _, old := range removed {
+		fmt.Printf("removed old snapshot %s\n", old)
+	}
+	return 0
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/satyaki-up/issuetracker/internal/issues"
+)
+
+// outputFormat is the value of the global --format flag. The zero value
+// keeps each command's default text output.
+type outputFormat struct {
+	name string // "", table, csv, yaml, ndjson, json or template
+	tmpl *template.Template
+}
+
+func parseFormat(value string) (outputFormat, error) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "", "table", "csv", "yaml", "ndjson", "json":
+		return outputFormat{name: value}, nil
+	}
+	text, explicit := strings.CutPrefix(value, "template=")
+	if !explicit && !strings.Contains(value, "{{") {
+		return outputFormat{}, fmt.Errorf("%w: unknown format %q (use table|csv|yaml|ndjson|json or a Go template such as '{{.ID}} {{.Title}}')", issues.ErrInvalidInput, value)
+	}
+	tmpl, err := template.New("format").Option("missingkey=error").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return outputFormat{}, fmt.Errorf("%w: invalid format template: %v", issues.ErrInvalidInput, err)
+	}
+	return outputFormat{name: "template", tmpl: tmpl}, nil
+}
+
+func (f outputFormat) isJSON() bool { return f.name == "json" }
+
+// withJSON folds a command's --json flag into the format.
+func (f outputFormat) withJSON(jsonOut bool) outputFormat {
+	if jsonOut {
+		return outputFormat{name: "json"}
+	}
+	return f
+}
+
+// report is one command result in every shape the formats need: data for
+// json and yaml, one item per record for ndjson and templates, and a header
+// plus string rows for csv and table.
+type report struct {
+	data   any
+	items  []any
+	header []string
+	rows   [][]string
+}
+
+func (f outputFormat) render(r report) error {
+	switch f.name {
+	case "json":
+		printJSON(r.data)
+	case "yaml":
+		raw, err := json.Marshal(r.data)
+		if err != nil {
+			return err
+		}
+		return writeYAML(os.Stdout, raw)
+	case "ndjson":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, item := range r.items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write(r.header)
+		_ = w.WriteAll(r.rows)
+		return w.Error()
+	case "table":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(r.header, "\t")))
+		for _, row := range r.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case "template":
+		for _, item := range r.items {
+			var buf bytes.Buffer
+			if err := f.tmpl.Execute(&buf, item); err != nil {
+				return fmt.Errorf("%w: format template: %v", issues.ErrInvalidInput, err)
+			}
+			line := buf.String()
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			fmt.Print(line)
+		}
+	}
+	return nil
+}
+
+const timeLayout = time.RFC3339
+
+var issueHeader = []string{"id", "category", "state", "version", "title", "assignee", "parent_id", "labels", "blocked_by", "blocks", "created_at", "last_updated_at", "closed_at"}
+
+func issueRow(is issues.Issue) []string {
+	closed := ""
+	if is.ClosedAt != nil {
+		closed = is.ClosedAt.Format(timeLayout)
+	}
+	return []string{
+		is.ID,
+		string(is.Category),
+		string(is.State),
+		strconv.FormatInt(is.Version, 10),
+		is.Title,
+		derefString(is.Assignee),
+		derefString(is.ParentID),
+		strings.Join(is.Labels, ","),
+		strings.Join(is.BlockedBy, ","),
+		strings.Join(is.Blocks, ","),
+		is.CreatedAt.Format(timeLayout),
+		is.LastUpdatedAt.Format(timeLayout),
+		closed,
+	}
+}
+
+func issuesReport(data any, list []issues.Issue) report {
+	r := report{data: data, header: issueHeader, items: make([]any, 0, len(list))}
+	for _, is := range list {
+		r.items = append(r.items, is)
+		r.rows = append(r.rows, issueRow(is))
+	}
+	return r
+}
+
+// treeRow is a tree node flattened for row formats; Depth is 0 for roots.
+type treeRow struct {
+	issues.Issue
+	Depth int `json:"depth"`
+}
+
+func treeReport(tree []issues.TreeNode) report {
+	r := report{data: tree, header: append([]string{"depth"}, issueHeader...), items: make([]any, 0)}
+	var walk func(node issues.TreeNode, depth int)
+	walk = func(node issues.TreeNode, depth int) {
+		r.items = append(r.items, treeRow{Issue: node.Issue, Depth: depth})
+		row := issueRow(node.Issue)
+		row[4] = strings.Repeat("  ", depth) + row[4]
+		r.rows = append(r.rows, append([]string{strconv.Itoa(depth)}, row...))
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	for _, node := range tree {
+		walk(node, 0)
+	}
+	return r
+}
+
+// searchRow flattens a search result so templates can use {{.ID}} as well
+// as {{.Snippet}}.
+type searchRow struct {
+	issues.Issue
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+func searchReport(results []issues.SearchResult) report {
+	r := report{data: results, header: []string{"id", "state", "title", "snippet", "rank"}, items: make([]any, 0, len(results))}
+	for _, res := range results {
+		r.items = append(r.items, searchRow{Issue: res.Issue, Snippet: res.Snippet, Rank: res.Rank})
+		r.rows = append(r.rows, []string{res.Issue.ID, string(res.Issue.State), res.Issue.Title, res.Snippet, strconv.FormatFloat(res.Rank, 'g', 6, 64)})
+	}
+	return r
+}
+
+func derefString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+// yamlPlainRe matches strings that YAML reads back unchanged without quotes.
+var yamlPlainRe = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_ ./@+-]*$`)
+
+// writeYAML re-emits a JSON document as block-style YAML, keeping key order.
+func writeYAML(w io.Writer, raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := yamlValue(&buf, dec, "", 0); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// yamlValue writes the next JSON value. prefix is what precedes it on the
+// current line ("key:" or "-", already indented), or empty at the document
+// root; col is the indentation of that line.
+func yamlValue(buf *bytes.Buffer, dec *json.Decoder, prefix string, col int) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+			empty := "{}"
+			if v == '[' {
+				empty = "[]"
+			}
+			buf.WriteString(joinPrefix(prefix, empty) + "\n")
+			return nil
+		}
+		// Children start on the same line after "-", otherwise on new
+		// lines indented under the key.
+		childCol := col
+		first := ""
+		switch {
+		case strings.HasSuffix(prefix, "-"):
+			childCol = col + 2
+			first = prefix + " "
+		case prefix != "":
+			childCol = col + 2
+			buf.WriteString(prefix + "\n")
+		}
+		for i := 0; dec.More(); i++ {
+			line := strings.Repeat(" ", childCol)
+			if i == 0 && first != "" {
+				line = first
+			}
+			if v == '[' {
+				line += "-"
+			} else {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				line += yamlString(keyTok.(string)) + ":"
+			}
+			if err := yamlValue(buf, dec, line, childCol); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	case string:
+		buf.WriteString(joinPrefix(prefix, yamlString(v)) + "\n")
+	case json.Number:
+		buf.WriteString(joinPrefix(prefix, v.String()) + "\n")
+	case bool:
+		buf.WriteString(joinPrefix(prefix, strconv.FormatBool(v)) + "\n")
+	case nil:
+		buf.WriteString(joinPrefix(prefix, "null") + "\n")
+	}
+	return nil
+}
+
+func joinPrefix(prefix, value string) string {
+	if prefix == "" {
+		return value
+	}
+	return prefix + " " + value
+}
+
+func yamlString(s string) string {
+	switch strings.ToLower(s) {
+	case "", "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if yamlPlainRe.MatchString(s) && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
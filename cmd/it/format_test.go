@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, value := range []string{"", "table", "csv", "yaml", "ndjson", "json"} {
+		f, err := parseFormat(value)
+		if err != nil || f.name != value {
+			t.Fatalf("parseFormat(%q) = %+v, %v", value, f, err)
+		}
+	}
+	for _, value := range []string{"{{.ID}}", "template=plain text"} {
+		f, err := parseFormat(value)
+		if err != nil || f.name != "template" || f.tmpl == nil {
+			t.Fatalf("parseFormat(%q) = %+v, %v", value, f, err)
+		}
+	}
+	for _, value := range []string{"xml", "{{.ID"} {
+		if _, err := parseFormat(value); err == nil {
+			t.Fatalf("parseFormat(%q): expected error", value)
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	raw := []byte(`[{"id":"cat-1","title":"Back end: api","labels":[],"blocked_by":["cat-2","cat-3"],"version":2,"archived":false,"parent_id":null,"nested":{"a":[[1]]}}]`)
+	want := `- id: cat-1
+  title: "Back end: api"
+  labels: []
+  blocked_by:
+    - cat-2
+    - cat-3
+  version: 2
+  archived: false
+  parent_id: null
+  nested:
+    a:
+      - - 1
+`
+	var buf bytes.Buffer
+	if err := writeYAML(&buf, raw); err != nil {
+		t.Fatalf("writeYAML: %v", err)
+	}
+	if buf.String() != want {
+		t.Fatalf("unexpected yaml:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
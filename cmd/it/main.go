@@ -2,11 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,8 +30,7 @@ func run() int {
 	if err == nil {
 		cfg, err := config.Discover(cwd)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: load itconfig: %v\n", err)
-			return 1
+			return renderError(fmt.Errorf("load itconfig: %w", err), jsonRequested(os.Args[1:]))
 		}
 		if cfg != nil {
 			cfgPath = cfg.Path
@@ -44,8 +44,14 @@ func run() int {
 	root := flag.NewFlagSet("it", flag.ContinueOnError)
 	root.SetOutput(os.Stderr)
 	dbPath := root.String("db", "", "SQLite database path")
-	if err := root.Parse(os.Args[1:]); err != nil {
-		return 1
+	actor := root.String("actor", "", "actor recorded in issue history (default $IT_ACTOR or $USER)")
+	formatArg := root.String("format", "", "output for show, list, tree, search: table|csv|yaml|ndjson|json or a Go template")
+	if code, ok := parseFlags(root, os.Args[1:]); !ok {
+		return code
+	}
+	format, err := parseFormat(*formatArg)
+	if err != nil {
+		return renderError(err, jsonRequested(root.Args()))
 	}
 	args := root.Args()
 	if len(args) == 0 {
@@ -56,34 +62,75 @@ func run() int {
 		*dbPath = defaultDBPath
 	}
 
-	database, err := db.Open(ctx, *dbPath)
+	switch args[0] {
+	case "schema":
+		_, _ = os.Stdout.Write(jsonSchema)
+		return 0
+	case "completion":
+		return handleCompletion(args[1:])
+	case "__complete":
+		return handleComplete(ctx, args[1:], *dbPath)
+	case "db":
+		return handleDB(ctx, *dbPath, args[1:])
+	}
+
+	database, err := openDatabase(ctx, *dbPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: open database: %v\n", err)
-		return 1
+		return renderError(fmt.Errorf("open database: %w", err), format.isJSON() || jsonRequested(args))
 	}
 	defer database.Close()
 
-	svc := issues.NewService(database)
+	if strings.TrimSpace(*actor) == "" {
+		*actor = defaultActor()
+	}
+	svc := issues.NewService(database).WithActor(*actor)
 
 	switch args[0] {
 	case "create":
 		return handleCreate(ctx, svc, args[1:], defaultProject)
 	case "show":
-		return handleShow(ctx, svc, args[1:])
+		return handleShow(ctx, svc, args[1:], format)
 	case "list":
-		return handleList(ctx, svc, args[1:], defaultProject)
+		return handleList(ctx, svc, args[1:], defaultProject, format)
+	case "view":
+		return handleView(ctx, svc, args[1:], defaultProject, format)
+	case "search":
+		return handleSearch(ctx, svc, args[1:], defaultProject, format)
+	case "ready":
+		return handleReady(ctx, svc, args[1:], defaultProject, format)
 	case "state":
 		return handleState(ctx, svc, args[1:])
+	case "edit":
+		return handleEdit(ctx, svc, args[1:])
 	case "parent":
 		return handleParent(ctx, svc, args[1:])
 	case "blocked-by":
 		return handleBlockedBy(ctx, svc, args[1:])
 	case "tree":
-		return handleTree(ctx, svc, args[1:], defaultProject)
+		return handleTree(ctx, svc, args[1:], defaultProject, format)
+	case "assign":
+		return handleAssign(ctx, svc, args[1:])
+	case "claim":
+		return handleClaim(ctx, svc, args[1:])
+	case "delete":
+		return handleDelete(ctx, svc, args[1:])
+	case "archive":
+		return handleArchive(ctx, svc, args[1:])
+	case "comment":
+		return handleComment(ctx, svc, args[1:])
+	case "label":
+		return handleLabel(ctx, svc, args[1:])
+	case "history":
+		return handleHistory(ctx, svc, args[1:])
+	case "doctor":
+		return handleDoctor(ctx, svc, args[1:])
 	case "help", "-h", "--help":
 		printUsage(cfgPath, defaultProject, *dbPath)
 		return 0
 	default:
+		if jsonRequested(args) {
+			return usageError(true, "unknown command %q", args[0])
+		}
 		fmt.Fprintf(os.Stderr, "error: unknown command %q\n", args[0])
 		printUsage(cfgPath, defaultProject, *dbPath)
 		return 1
@@ -100,16 +147,15 @@ func handleCreate(ctx context.Context, svc *issues.Service, args []string, defau
 	parent := fs.String("p", "", "parent issue id")
 	blockedBy := fs.String("blocked-by", "", "comma-separated dependency issue ids")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
 	if strings.TrimSpace(*project) == "" {
 		*project = defaultProject
 	}
 	categoryValue, err := parseCategoryArg(*categoryShort)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return 2
+		return renderError(fmt.Errorf("%w: %v", issues.ErrInvalidInput, err), *jsonOut)
 	}
 
 	var parentID *string
@@ -119,7 +165,7 @@ func handleCreate(ctx context.Context, svc *issues.Service, args []string, defau
 	}
 	issue, err := svc.CreateIssue(ctx, *project, categoryValue, *title, *body, parentID, parseCSV(*blockedBy))
 	if err != nil {
-		return renderError(err)
+		return renderError(err, *jsonOut)
 	}
 
 	if *jsonOut {
@@ -130,68 +176,370 @@ func handleCreate(ctx context.Context, svc *issues.Service, args []string, defau
 	return 0
 }
 
-func handleShow(ctx context.Context, svc *issues.Service, args []string) int {
+func handleShow(ctx context.Context, svc *issues.Service, args []string, format outputFormat) int {
 	fs := flag.NewFlagSet("show", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	id := fs.String("id", "", "issue id")
+	withComments := fs.Bool("comments", false, "include comments in JSON output")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
+	format = format.withJSON(*jsonOut)
 	issue, err := svc.GetIssue(ctx, *id)
 	if err != nil {
-		return renderError(err)
+		return renderError(err, format.isJSON())
 	}
-	if *jsonOut {
-		printJSON(issue)
+	if format.name == "" || *withComments {
+		comments, err := svc.ListComments(ctx, issue.ID)
+		if err != nil {
+			return renderError(err, format.isJSON())
+		}
+		issue.Comments = comments
+	}
+	if format.name != "" {
+		if err := format.render(issuesReport(issue, []issues.Issue{*issue})); err != nil {
+			return renderError(err, format.isJSON())
+		}
 		return 0
 	}
-	printIssue(*issue)
+	r, err := rendererFor(ctx, svc, []issues.Issue{*issue})
+	if err != nil {
+		return renderError(err, false)
+	}
+	r.issue(*issue)
 	return 0
 }
 
-func handleList(ctx context.Context, svc *issues.Service, args []string, defaultProject string) int {
+func handleList(ctx context.Context, svc *issues.Service, args []string, defaultProject string, format outputFormat) int {
 	fs := flag.NewFlagSet("list", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
+	lf := addListFlags(fs)
+	limit := fs.Int("limit", 0, "maximum number of issues per page (0 = all)")
+	cursor := fs.String("cursor", "", "resume from the next_cursor of a previous page")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	format = format.withJSON(*jsonOut)
+
+	filter, err := lf.filter(svc, defaultProject, time.Now())
+	if err != nil {
+		return renderError(err, format.isJSON())
+	}
+	filter.Limit = *limit
+	filter.Cursor = strings.TrimSpace(*cursor)
+
+	list, next, err := svc.ListIssues(ctx, filter)
+	if err != nil {
+		return renderError(err, format.isJSON())
+	}
+	return printIssueList(ctx, svc, list, next, true, format)
+}
+
+// printIssueList prints list in format. Commands that take --cursor set
+// paged, and their structured output is always an issuePage, whether or not
+// this request was limited.
+func printIssueList(ctx context.Context, svc *issues.Service, list []issues.Issue, next string, paged bool, format outputFormat) int {
+	if format.name != "" {
+		var data any = list
+		if paged {
+			data = issuePage{Issues: list, NextCursor: next}
+		}
+		if err := format.render(issuesReport(data, list)); err != nil {
+			return renderError(err, format.isJSON())
+		}
+		if next != "" && !format.isJSON() && format.name != "yaml" {
+			fmt.Fprintf(os.Stderr, "next cursor: %s\n", next)
+		}
+		return 0
+	}
+	r, err := rendererFor(ctx, svc, list)
+	if err != nil {
+		return renderError(err, false)
+	}
+	r.issueList(list)
+	if next != "" {
+		fmt.Fprintf(os.Stderr, "next cursor: %s\n", next)
+	}
+	return 0
+}
+
+// issuePage is the JSON shape of a paginated list.
+type issuePage struct {
+	Issues     []issues.Issue `json:"issues"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// listFlags holds the raw filter and sort flags shared by commands that
+// select issues.
+type listFlags struct {
+	project           *string
+	states            *string
+	categories        *string
+	parent            *string
+	under             *string
+	assignee          *string
+	anyLabels         *string
+	allLabels         *string
+	createdAfter      *string
+	createdBefore     *string
+	updatedAfter      *string
+	updatedBefore     *string
+	closedAfter       *string
+	closedBefore      *string
+	hasUnresolvedDeps *string
+	includeArchived   *bool
+	query             *string
+	sort              *string
+	reverse           *bool
+}
+
+func addListFlags(fs *flag.FlagSet) *listFlags {
+	return &listFlags{
+		project:           fs.String("project", "", "project prefix"),
+		states:            fs.String("state", "", "comma-separated state filter"),
+		categories:        fs.String("category", "", "comma-separated category filter: task|workstream|project or t|w|p"),
+		parent:            fs.String("parent", "", "only direct children of this issue"),
+		under:             fs.String("under", "", "only descendants of this issue at any depth"),
+		assignee:          fs.String("assignee", "", "assignee filter (me = current actor)"),
+		anyLabels:         fs.String("label", "", "comma-separated labels; match issues with any of them"),
+		allLabels:         fs.String("all-labels", "", "comma-separated labels; match issues with all of them"),
+		createdAfter:      fs.String("created-after", "", "created at or after: YYYY-MM-DD, RFC 3339 or age like 7d"),
+		createdBefore:     fs.String("created-before", "", "created before: YYYY-MM-DD, RFC 3339 or age like 7d"),
+		updatedAfter:      fs.String("updated-after", "", "updated at or after: YYYY-MM-DD, RFC 3339 or age like 7d"),
+		updatedBefore:     fs.String("updated-before", "", "updated before: YYYY-MM-DD, RFC 3339 or age like 7d"),
+		closedAfter:       fs.String("closed-after", "", "closed at or after: YYYY-MM-DD, RFC 3339 or age like 7d"),
+		closedBefore:      fs.String("closed-before", "", "closed before: YYYY-MM-DD, RFC 3339 or age like 7d"),
+		hasUnresolvedDeps: fs.String("has-unresolved-deps", "", "true|false: filter on blocked_by entries that are not done"),
+		includeArchived:   fs.Bool("include-archived", false, "include archived issues"),
+		query:             fs.String("q", "", `query expression, e.g. "state:todo category:task updated>7d blocked:false"`),
+		sort:              fs.String("sort", "created", "sort by created|updated|closed|id|title|state"),
+		reverse:           fs.Bool("reverse", false, "reverse sort order"),
+	}
+}
+
+func (lf *listFlags) filter(svc *issues.Service, defaultProject string, now time.Time) (issues.ListFilter, error) {
+	filter := issues.ListFilter{
+		ProjectPrefix:   strings.TrimSpace(*lf.project),
+		ParentID:        strings.TrimSpace(*lf.parent),
+		AncestorID:      strings.TrimSpace(*lf.under),
+		AnyLabels:       parseCSV(*lf.anyLabels),
+		AllLabels:       parseCSV(*lf.allLabels),
+		IncludeArchived: *lf.includeArchived,
+		Query:           *lf.query,
+		Sort:            issues.SortField(strings.TrimSpace(*lf.sort)),
+		Reverse:         *lf.reverse,
+	}
+	if filter.ProjectPrefix == "" {
+		filter.ProjectPrefix = defaultProject
+	}
+	for _, st := range parseCSV(*lf.states) {
+		filter.States = append(filter.States, issues.State(st))
+	}
+	for _, c := range parseCSV(*lf.categories) {
+		category, err := parseCategoryArg(c)
+		if err != nil {
+			return issues.ListFilter{}, fmt.Errorf("%w: %v", issues.ErrInvalidInput, err)
+		}
+		filter.Categories = append(filter.Categories, category)
+	}
+
+	assignee, err := resolveAssignee(svc, *lf.assignee)
+	if err != nil {
+		return issues.ListFilter{}, fmt.Errorf("%w: %v", issues.ErrInvalidInput, err)
+	}
+	filter.Assignee = assignee
+
+	bounds := []struct {
+		raw  string
+		dest **time.Time
+	}{
+		{*lf.createdAfter, &filter.CreatedAfter},
+		{*lf.createdBefore, &filter.CreatedBefore},
+		{*lf.updatedAfter, &filter.UpdatedAfter},
+		{*lf.updatedBefore, &filter.UpdatedBefore},
+		{*lf.closedAfter, &filter.ClosedAfter},
+		{*lf.closedBefore, &filter.ClosedBefore},
+	}
+	for _, b := range bounds {
+		if strings.TrimSpace(b.raw) == "" {
+			continue
+		}
+		t, err := issues.ParseTimeBound(b.raw, now)
+		if err != nil {
+			return issues.ListFilter{}, err
+		}
+		*b.dest = &t
+	}
+
+	blocked, err := lf.blocked()
+	if err != nil {
+		return issues.ListFilter{}, err
+	}
+	filter.HasUnresolvedDeps = blocked
+	return filter, nil
+}
+
+// blocked parses --has-unresolved-deps, returning nil when it is unset.
+func (lf *listFlags) blocked() (*bool, error) {
+	raw := strings.TrimSpace(*lf.hasUnresolvedDeps)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: --has-unresolved-deps must be true or false", issues.ErrInvalidInput)
+	}
+	return &v, nil
+}
+
+// view converts the flags into a saved view. Values are kept as typed so
+// that "me" and relative times resolve each time the view runs.
+func (lf *listFlags) view(name string) (issues.View, error) {
+	blocked, err := lf.blocked()
+	if err != nil {
+		return issues.View{}, err
+	}
+	var terms []string
+	add := func(field, op string, values ...string) {
+		var quoted []string
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				quoted = append(quoted, queryValue(v))
+			}
+		}
+		if len(quoted) > 0 {
+			terms = append(terms, field+op+strings.Join(quoted, ","))
+		}
+	}
+	add("state", ":", parseCSV(*lf.states)...)
+	add("category", ":", parseCSV(*lf.categories)...)
+	add("parent", ":", *lf.parent)
+	add("under", ":", *lf.under)
+	add("assignee", ":", *lf.assignee)
+	add("label", ":", parseCSV(*lf.anyLabels)...)
+	for _, l := range parseCSV(*lf.allLabels) {
+		add("label", ":", l)
+	}
+	add("created", ">=", *lf.createdAfter)
+	add("created", "<", *lf.createdBefore)
+	add("updated", ">=", *lf.updatedAfter)
+	add("updated", "<", *lf.updatedBefore)
+	add("closed", ">=", *lf.closedAfter)
+	add("closed", "<", *lf.closedBefore)
+	if blocked != nil {
+		add("blocked", ":", strconv.FormatBool(*blocked))
+	}
+	if q := strings.TrimSpace(*lf.query); q != "" {
+		terms = append(terms, q)
+	}
+	sort := issues.SortField(strings.TrimSpace(*lf.sort))
+	if sort == issues.SortCreated {
+		sort = ""
+	}
+	return issues.View{
+		Name:            name,
+		ProjectPrefix:   strings.TrimSpace(*lf.project),
+		Query:           strings.Join(terms, " "),
+		Sort:            sort,
+		Reverse:         *lf.reverse,
+		IncludeArchived: *lf.includeArchived,
+	}, nil
+}
+
+// queryValue quotes a value for the query language when it is empty or
+// contains whitespace or a character the query syntax gives a meaning to,
+// escaping backslashes and quotes inside.
+func queryValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\n\",:=!<>\\") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+func handleSearch(ctx context.Context, svc *issues.Service, args []string, defaultProject string, format outputFormat) int {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
 	project := fs.String("project", "", "project prefix")
-	stateArg := fs.String("state", "", "state filter")
+	stateArg := fs.String("state", "", "comma-separated state filter")
+	includeArchived := fs.Bool("include-archived", false, "include archived issues")
+	limit := fs.Int("limit", 20, "maximum number of results (0 = all)")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+
+	// Query words may appear anywhere among the flags.
+	var terms []string
+	for {
+		if code, ok := parseFlags(fs, args); !ok {
+			return code
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		terms = append(terms, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
+	format = format.withJSON(*jsonOut)
 	if strings.TrimSpace(*project) == "" {
 		*project = defaultProject
 	}
 
-	var state *issues.State
-	if strings.TrimSpace(*stateArg) != "" {
-		s := issues.State(strings.TrimSpace(*stateArg))
-		state = &s
+	filter := issues.ListFilter{
+		ProjectPrefix:   *project,
+		IncludeArchived: *includeArchived,
+		Limit:           *limit,
+	}
+	for _, st := range parseCSV(*stateArg) {
+		filter.States = append(filter.States, issues.State(st))
 	}
 
-	list, err := svc.ListIssues(ctx, *project, state)
+	results, err := svc.Search(ctx, strings.Join(terms, " "), filter)
 	if err != nil {
-		return renderError(err)
+		return renderError(err, format.isJSON())
 	}
-	if *jsonOut {
-		printJSON(list)
+	if format.name != "" {
+		if err := format.render(searchReport(results)); err != nil {
+			return renderError(err, format.isJSON())
+		}
 		return 0
 	}
-	for _, is := range list {
-		fmt.Printf("%s\t%s\t%s\tv%d\t%s\n", is.ID, is.Category, is.State, is.Version, is.Title)
+	for _, r := range results {
+		fmt.Printf("%s\t%s\t%s\t%s\n", r.Issue.ID, r.Issue.State, r.Issue.Title, strings.ReplaceAll(r.Snippet, "\n", " "))
 	}
 	return 0
 }
 
+func handleReady(ctx context.Context, svc *issues.Service, args []string, defaultProject string, format outputFormat) int {
+	fs := flag.NewFlagSet("ready", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	project := fs.String("project", "", "project prefix")
+	limit := fs.Int("limit", 0, "maximum number of tasks to return (0 = all)")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	format = format.withJSON(*jsonOut)
+	if strings.TrimSpace(*project) == "" {
+		*project = defaultProject
+	}
+
+	list, err := svc.ReadyIssues(ctx, *project, *limit)
+	if err != nil {
+		return renderError(err, format.isJSON())
+	}
+	return printIssueList(ctx, svc, list, "", false, format)
+}
+
 func handleState(ctx context.Context, svc *issues.Service, args []string) int {
 	fs := flag.NewFlagSet("state", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	id := fs.String("id", "", "issue id")
 	to := fs.String("to", "", "target state")
+	blockedReason := fs.String("blocked-reason", "", "why the issue is blocked (required with --to blocked)")
 	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
 
 	var expectedPtr *int64
@@ -200,9 +548,9 @@ func handleState(ctx context.Context, svc *issues.Service, args []string) int {
 		expectedPtr = &ev
 	}
 
-	updated, err := svc.TransitionState(ctx, *id, issues.State(strings.TrimSpace(*to)), expectedPtr)
+	updated, err := svc.TransitionState(ctx, *id, issues.State(strings.TrimSpace(*to)), *blockedReason, expectedPtr)
 	if err != nil {
-		return renderError(err)
+		return renderError(err, *jsonOut)
 	}
 	if *jsonOut {
 		printJSON(updated)
@@ -212,6 +560,56 @@ func handleState(ctx context.Context, svc *issues.Service, args []string) int {
 	return 0
 }
 
+func handleEdit(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	title := fs.String("title", "", "new issue title")
+	body := fs.String("body", "", "new issue description")
+	bodyFile := fs.String("body-file", "", "read new description from file (- for stdin)")
+	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["body"] && set["body-file"] {
+		return renderError(fmt.Errorf("%w: use either --body or --body-file", issues.ErrInvalidInput), *jsonOut)
+	}
+
+	var titlePtr, bodyPtr *string
+	if set["title"] {
+		titlePtr = title
+	}
+	if set["body"] {
+		bodyPtr = body
+	}
+	if set["body-file"] {
+		content, err := readBodyFile(*bodyFile)
+		if err != nil {
+			return renderError(err, *jsonOut)
+		}
+		bodyPtr = &content
+	}
+	var expectedPtr *int64
+	if *expectedVersion >= 0 {
+		ev := *expectedVersion
+		expectedPtr = &ev
+	}
+
+	updated, err := svc.UpdateIssue(ctx, *id, titlePtr, bodyPtr, expectedPtr)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(updated)
+		return 0
+	}
+	fmt.Printf("updated %s (v%d)\n", updated.ID, updated.Version)
+	return 0
+}
+
 func handleParent(ctx context.Context, svc *issues.Service, args []string) int {
 	fs := flag.NewFlagSet("parent", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
@@ -220,12 +618,11 @@ func handleParent(ctx context.Context, svc *issues.Service, args []string) int {
 	clear := fs.Bool("clear", false, "remove parent")
 	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
 	if *clear && strings.TrimSpace(*parent) != "" {
-		fmt.Fprintln(os.Stderr, "error: use either -p or --clear")
-		return 2
+		return renderError(fmt.Errorf("%w: use either -p or --clear", issues.ErrInvalidInput), *jsonOut)
 	}
 
 	var parentID *string
@@ -241,7 +638,7 @@ func handleParent(ctx context.Context, svc *issues.Service, args []string) int {
 
 	updated, err := svc.SetParent(ctx, *id, parentID, expectedPtr)
 	if err != nil {
-		return renderError(err)
+		return renderError(err, *jsonOut)
 	}
 	if *jsonOut {
 		printJSON(updated)
@@ -255,29 +652,46 @@ func handleParent(ctx context.Context, svc *issues.Service, args []string) int {
 	return 0
 }
 
-func handleTree(ctx context.Context, svc *issues.Service, args []string, defaultProject string) int {
+func handleTree(ctx context.Context, svc *issues.Service, args []string, defaultProject string, format outputFormat) int {
 	fs := flag.NewFlagSet("tree", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	project := fs.String("project", "", "project prefix")
+	includeArchived := fs.Bool("include-archived", false, "include archived issues")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
+	format = format.withJSON(*jsonOut)
 	if strings.TrimSpace(*project) == "" {
 		*project = defaultProject
 	}
 
-	tree, err := svc.Tree(ctx, *project)
+	tree, err := svc.Tree(ctx, *project, *includeArchived)
 	if err != nil {
-		return renderError(err)
+		return renderError(err, format.isJSON())
 	}
-	if *jsonOut {
-		printJSON(tree)
+	if format.name != "" {
+		if err := format.render(treeReport(tree)); err != nil {
+			return renderError(err, format.isJSON())
+		}
 		return 0
 	}
+	var all []issues.Issue
+	var walk func(node issues.TreeNode)
+	walk = func(node issues.TreeNode) {
+		all = append(all, node.Issue)
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
 	for _, node := range tree {
-		printTree(node, 0)
+		walk(node)
 	}
+	r, err := rendererFor(ctx, svc, all)
+	if err != nil {
+		return renderError(err, false)
+	}
+	r.tree(tree)
 	return 0
 }
 
@@ -289,12 +703,11 @@ func handleBlockedBy(ctx context.Context, svc *issues.Service, args []string) in
 	clear := fs.Bool("clear", false, "remove all dependencies")
 	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
 	jsonOut := fs.Bool("json", false, "print JSON")
-	if err := fs.Parse(args); err != nil {
-		return 1
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
 	if *clear && strings.TrimSpace(*set) != "" {
-		fmt.Fprintln(os.Stderr, "error: use either --set or --clear")
-		return 2
+		return renderError(fmt.Errorf("%w: use either --set or --clear", issues.ErrInvalidInput), *jsonOut)
 	}
 
 	blockedBy := []string{}
@@ -310,7 +723,7 @@ func handleBlockedBy(ctx context.Context, svc *issues.Service, args []string) in
 
 	updated, err := svc.SetBlockedBy(ctx, *id, blockedBy, expectedPtr)
 	if err != nil {
-		return renderError(err)
+		return renderError(err, *jsonOut)
 	}
 	if *jsonOut {
 		printJSON(updated)
@@ -320,66 +733,534 @@ func handleBlockedBy(ctx context.Context, svc *issues.Service, args []string) in
 	return 0
 }
 
-func renderError(err error) int {
-	fmt.Fprintf(os.Stderr, "error: %v\n", err)
-	switch {
-	case errors.Is(err, issues.ErrInvalidInput), errors.Is(err, issues.ErrInvalidStateTransition):
-		return 2
-	case errors.Is(err, issues.ErrNotFound):
-		return 3
-	case errors.Is(err, issues.ErrConflict), errors.Is(err, issues.ErrDepthExceeded), errors.Is(err, issues.ErrCycleDetected):
-		return 4
+func handleAssign(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("assign", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	to := fs.String("to", "", "assignee (me = current actor)")
+	clear := fs.Bool("clear", false, "remove assignee")
+	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *clear == (strings.TrimSpace(*to) != "") {
+		return renderError(fmt.Errorf("%w: use either --to or --clear", issues.ErrInvalidInput), *jsonOut)
+	}
+
+	var expectedPtr *int64
+	if *expectedVersion >= 0 {
+		ev := *expectedVersion
+		expectedPtr = &ev
+	}
+
+	assignee, err := resolveAssignee(svc, *to)
+	if err != nil {
+		return renderError(fmt.Errorf("%w: %v", issues.ErrInvalidInput, err), *jsonOut)
+	}
+
+	updated, err := svc.AssignIssue(ctx, *id, assignee, expectedPtr)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(updated)
+		return 0
+	}
+	if updated.Assignee == nil {
+		fmt.Printf("unassigned %s (v%d)\n", updated.ID, updated.Version)
+		return 0
+	}
+	fmt.Printf("assigned %s to %s (v%d)\n", updated.ID, *updated.Assignee, updated.Version)
+	return 0
+}
+
+func handleClaim(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("claim", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	as := fs.String("as", "", "assignee (default current actor)")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	assignee, err := resolveAssignee(svc, *as)
+	if err != nil {
+		return renderError(fmt.Errorf("%w: %v", issues.ErrInvalidInput, err), *jsonOut)
+	}
+	if assignee == "" {
+		assignee = svc.Actor()
+	}
+
+	claimed, err := svc.ClaimIssue(ctx, *id, assignee)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(claimed)
+		return 0
+	}
+	fmt.Printf("claimed %s for %s (v%d)\n", claimed.ID, *claimed.Assignee, claimed.Version)
+	return 0
+}
+
+func handleDelete(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	cascade := fs.Bool("cascade", false, "also delete all descendants")
+	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	var expectedPtr *int64
+	if *expectedVersion >= 0 {
+		ev := *expectedVersion
+		expectedPtr = &ev
+	}
+
+	deleted, err := svc.DeleteIssue(ctx, *id, *cascade, expectedPtr)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(map[string][]string{"deleted": deleted})
+		return 0
+	}
+	fmt.Printf("deleted %s\n", strings.Join(deleted, ","))
+	return 0
+}
+
+func handleArchive(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	cascade := fs.Bool("cascade", false, "also archive all descendants")
+	expectedVersion := fs.Int64("expected-version", -1, "optimistic concurrency check")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	var expectedPtr *int64
+	if *expectedVersion >= 0 {
+		ev := *expectedVersion
+		expectedPtr = &ev
+	}
+
+	archived, err := svc.ArchiveIssue(ctx, *id, *cascade, expectedPtr)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(archived)
+		return 0
+	}
+	fmt.Printf("archived %s (v%d)\n", archived.ID, archived.Version)
+	return 0
+}
+
+func handleView(ctx context.Context, svc *issues.Service, args []string, defaultProject string, format outputFormat) int {
+	if len(args) == 0 {
+		return usageError(false, "view requires a subcommand: save|run|list|delete")
+	}
+	switch args[0] {
+	case "save":
+		return handleViewSave(ctx, svc, args[1:])
+	case "run":
+		return handleViewRun(ctx, svc, args[1:], defaultProject, format)
+	case "list":
+		return handleViewList(ctx, svc, args[1:])
+	case "delete":
+		return handleViewDelete(ctx, svc, args[1:])
 	default:
-		return 1
+		return usageError(jsonRequested(args), "unknown view subcommand %q (use save|run|list|delete)", args[0])
+	}
+}
+
+// viewName splits the leading view name off the arguments.
+func viewName(cmd string, args []string) (string, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", nil, fmt.Errorf("%w: view %s requires a view name", issues.ErrInvalidInput, cmd)
+	}
+	return args[0], args[1:], nil
+}
+
+func handleViewSave(ctx context.Context, svc *issues.Service, args []string) int {
+	name, rest, err := viewName("save", args)
+	if err != nil {
+		return renderError(err, jsonRequested(args))
+	}
+	fs := flag.NewFlagSet("view save", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	lf := addListFlags(fs)
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, rest); !ok {
+		return code
+	}
+
+	spec, err := lf.view(name)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	view, err := svc.SaveView(ctx, spec)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(view)
+		return 0
+	}
+	fmt.Printf("saved view %s: %s\n", view.Name, view.Query)
+	return 0
+}
+
+func handleViewRun(ctx context.Context, svc *issues.Service, args []string, defaultProject string, format outputFormat) int {
+	name, rest, err := viewName("run", args)
+	if err != nil {
+		return renderError(err, jsonRequested(args))
+	}
+	fs := flag.NewFlagSet("view run", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	limit := fs.Int("limit", 0, "maximum number of issues per page (0 = all)")
+	cursor := fs.String("cursor", "", "resume from the next_cursor of a previous page")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, rest); !ok {
+		return code
+	}
+	format = format.withJSON(*jsonOut)
+
+	view, err := svc.GetView(ctx, name)
+	if err != nil {
+		return renderError(err, format.isJSON())
+	}
+	filter := view.Filter()
+	if filter.ProjectPrefix == "" {
+		filter.ProjectPrefix = defaultProject
+	}
+	filter.Limit = *limit
+	filter.Cursor = strings.TrimSpace(*cursor)
+
+	list, next, err := svc.ListIssues(ctx, filter)
+	if err != nil {
+		return renderError(err, format.isJSON())
+	}
+	return printIssueList(ctx, svc, list, next, true, format)
+}
+
+func handleViewList(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("view list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	views, err := svc.ListViews(ctx)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(views)
+		return 0
+	}
+	for _, v := range views {
+		var opts []string
+		if v.ProjectPrefix != "" {
+			opts = append(opts, "project="+v.ProjectPrefix)
+		}
+		if v.Sort != "" {
+			opts = append(opts, "sort="+string(v.Sort))
+		}
+		if v.Reverse {
+			opts = append(opts, "reverse")
+		}
+		if v.IncludeArchived {
+			opts = append(opts, "include-archived")
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", v.Name, v.Query, strings.Join(opts, ","), v.CreatedBy)
+	}
+	return 0
+}
+
+func handleViewDelete(ctx context.Context, svc *issues.Service, args []string) int {
+	name, rest, err := viewName("delete", args)
+	if err != nil {
+		return renderError(err, jsonRequested(args))
+	}
+	fs := flag.NewFlagSet("view delete", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, rest); !ok {
+		return code
+	}
+
+	if err := svc.DeleteView(ctx, name); err != nil {
+		return renderError(err, *jsonOut)
+	}
+	name = strings.ToLower(name)
+	if *jsonOut {
+		printJSON(map[string]string{"deleted": name})
+		return 0
+	}
+	fmt.Printf("deleted view %s\n", name)
+	return 0
+}
+
+func handleComment(ctx context.Context, svc *issues.Service, args []string) int {
+	if len(args) == 0 {
+		return usageError(false, "comment requires a subcommand: add|list")
+	}
+	switch args[0] {
+	case "add":
+		return handleCommentAdd(ctx, svc, args[1:])
+	case "list":
+		return handleCommentList(ctx, svc, args[1:])
+	default:
+		return usageError(jsonRequested(args), "unknown comment subcommand %q (use add|list)", args[0])
+	}
+}
+
+func handleCommentAdd(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("comment add", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	text := fs.String("text", "", "comment text")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	comment, err := svc.AddComment(ctx, *id, *text)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(comment)
+		return 0
+	}
+	fmt.Printf("added comment %d to %s\n", comment.ID, comment.IssueID)
+	return 0
+}
+
+func handleCommentList(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("comment list", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	comments, err := svc.ListComments(ctx, *id)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(comments)
+		return 0
+	}
+	for _, c := range comments {
+		printComment(c)
+	}
+	return 0
+}
+
+func handleLabel(ctx context.Context, svc *issues.Service, args []string) int {
+	if len(args) == 0 || (args[0] != "add" && args[0] != "remove") {
+		return usageError(jsonRequested(args), "label requires a subcommand: add|remove")
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("label "+action, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args[1:]); !ok {
+		return code
+	}
+	labels := parseCSV(strings.Join(fs.Args(), ","))
+
+	var updated *issues.Issue
+	var err error
+	if action == "add" {
+		updated, err = svc.AddLabels(ctx, *id, labels)
+	} else {
+		updated, err = svc.RemoveLabels(ctx, *id, labels)
+	}
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(updated)
+		return 0
+	}
+	fmt.Printf("labels for %s: %s (v%d)\n", updated.ID, strings.Join(updated.Labels, ","), updated.Version)
+	return 0
+}
+
+func handleHistory(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	id := fs.String("id", "", "issue id")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
+
+	events, err := svc.History(ctx, *id)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	if *jsonOut {
+		printJSON(events)
+		return 0
+	}
+	for _, ev := range events {
+		printEvent(ev)
+	}
+	return 0
 }
 
-func printJSON(v any) {
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	_ = enc.Encode(v)
+// doctorResult is the JSON shape of doctor.
+type doctorResult struct {
+	Problems  []issues.Problem `json:"problems"`
+	Fixed     int              `json:"fixed"`
+	Remaining int              `json:"remaining"`
 }
 
-func printIssue(is issues.Issue) {
-	fmt.Printf("id: %s\n", is.ID)
-	fmt.Printf("project: %s\n", is.ProjectPrefix)
-	fmt.Printf("category: %s\n", is.Category)
-	fmt.Printf("state: %s\n", is.State)
-	fmt.Printf("version: %d\n", is.Version)
-	if is.ParentID != nil {
-		fmt.Printf("parent: %s\n", *is.ParentID)
+// handleDoctor reports violated invariants and, with --fix, repairs the
+// fixable ones. It exits 1 while any problem remains.
+func handleDoctor(ctx context.Context, svc *issues.Service, args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fix := fs.Bool("fix", false, "repair fixable problems")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	problems, err := svc.Doctor(ctx, *fix)
+	if err != nil {
+		return renderError(err, *jsonOut)
+	}
+	res := doctorResult{Problems: problems}
+	if res.Problems == nil {
+		res.Problems = []issues.Problem{}
+	}
+	for _, p := range problems {
+		if p.Fixed {
+			res.Fixed++
+		} else {
+			res.Remaining++
+		}
+	}
+
+	if *jsonOut {
+		printJSON(res)
+	} else {
+		for _, p := range problems {
+			issue := p.IssueID
+			if issue == "" {
+				issue = "-"
+			}
+			status := ""
+			switch {
+			case p.Fixed:
+				status = "\tfixed"
+			case p.Fixable:
+				status = "\tfixable"
+			}
+			fmt.Printf("%s\t%s\t%s%s\n", p.Check, issue, p.Message, status)
+		}
+		switch {
+		case len(problems) == 0:
+			fmt.Println("no problems found")
+		case *fix:
+			fmt.Printf("%d problem(s), %d fixed\n", len(problems), res.Fixed)
+		default:
+			fixable := 0
+			for _, p := range problems {
+				if p.Fixable {
+					fixable++
+				}
+			}
+			fmt.Printf("%d problem(s), %d fixable with --fix\n", len(problems), fixable)
+		}
 	}
-	fmt.Printf("title: %s\n", is.Title)
-	if is.Body != "" {
-		fmt.Printf("body: %s\n", is.Body)
+	if res.Remaining > 0 {
+		return 1
 	}
-	if len(is.BlockedBy) > 0 {
-		fmt.Printf("blocked_by: %s\n", strings.Join(is.BlockedBy, ","))
+	return 0
+}
+
+func printComment(c issues.Comment) {
+	author := c.Author
+	if author == "" {
+		author = "-"
 	}
-	fmt.Printf("created_at: %s\n", is.CreatedAt.Format(time.RFC3339))
-	fmt.Printf("last_updated_at: %s\n", is.LastUpdatedAt.Format(time.RFC3339))
-	if is.ClosedAt != nil {
-		fmt.Printf("closed_at: %s\n", is.ClosedAt.Format(time.RFC3339))
+	fmt.Printf("#%d\t%s\t%s\t%s\n", c.ID, c.CreatedAt.Format(time.RFC3339), author, c.Body)
+}
+
+func printEvent(ev issues.Event) {
+	actor := ev.Actor
+	if actor == "" {
+		actor = "-"
 	}
+	fmt.Printf("%s\tv%d\t%s\t%s\t%s -> %s\n", ev.CreatedAt.Format(time.RFC3339), ev.Version, actor, ev.Kind, eventValue(ev.OldValue), eventValue(ev.NewValue))
 }
 
-func printTree(node issues.TreeNode, level int) {
-	indent := strings.Repeat("  ", level)
-	fmt.Printf("%s- %s (%s) [%s] v%d %s\n", indent, node.Issue.ID, node.Issue.Category, node.Issue.State, node.Issue.Version, node.Issue.Title)
-	for _, child := range node.Children {
-		printTree(child, level+1)
+func eventValue(v *string) string {
+	if v == nil {
+		return "(none)"
 	}
+	return *v
 }
 
 func printUsage(configPath, defaultProject, defaultDB string) {
 	fmt.Fprint(os.Stderr, `Usage:
   it [--db PATH] create --project cat [-c t|w|p] --title "..." [--body "..."] [-p cat-1] [--blocked-by cat-2,cat-3] [--json]
-  it [--db PATH] show --id cat-1 [--json]
-  it [--db PATH] list [--project cat] [--state todo] [--json]
-  it [--db PATH] state --id cat-1 --to in_progress [--expected-version N] [--json]
+  it [--db PATH] show --id cat-1 [--comments] [--json]
+  it [--db PATH] list [--project cat] [--state todo,in_progress] [--category t,w] [--parent cat-2|--under cat-1]
+                      [--assignee NAME|me] [--label a,b] [--all-labels a,b]
+                      [--created-after|--created-before|--updated-after|--updated-before|--closed-after|--closed-before DATE|7d]
+                      [--has-unresolved-deps true|false] [--include-archived] [--q "state:todo updated>7d ..."]
+                      [--sort created|updated|closed|id|title|state] [--reverse]
+                      [--limit N] [--cursor C] [--json]
+  it [--db PATH] search "query" [--project cat] [--state todo] [--include-archived] [--limit N] [--json]
+  it [--db PATH] view save NAME [list filter flags] [--json]
+  it [--db PATH] view run NAME [--limit N] [--cursor C] [--json]
+  it [--db PATH] view list [--json]
+  it [--db PATH] view delete NAME
+  it [--db PATH] ready [--project cat] [--limit N] [--json]
+  it [--db PATH] state --id cat-1 --to in_progress|blocked [--blocked-reason "..."] [--expected-version N] [--json]
+  it [--db PATH] edit --id cat-1 [--title "..."] [--body "..."|--body-file PATH] [--expected-version N] [--json]
+  it [--db PATH] assign --id cat-1 [--to NAME|me|--clear] [--expected-version N] [--json]
+  it [--db PATH] claim --id cat-1 [--as NAME] [--json]
   it [--db PATH] parent --id cat-2 [-p cat-1|--clear] [--expected-version N] [--json]
   it [--db PATH] blocked-by --id cat-2 [--set cat-1,cat-3|--clear] [--expected-version N] [--json]
-  it [--db PATH] tree --project cat [--json]
+  it [--db PATH] tree --project cat [--include-archived] [--json]
+  it [--db PATH] archive --id cat-1 [--cascade] [--expected-version N] [--json]
+  it [--db PATH] delete --id cat-1 [--cascade] [--expected-version N] [--json]
+  it [--db PATH] label add|remove --id cat-1 bug,backend [--json]
+  it [--db PATH] comment add --id cat-1 --text "..." [--json]
+  it [--db PATH] comment list --id cat-1 [--json]
+  it [--db PATH] history --id cat-1 [--json]
+  it [--db PATH] doctor [--fix] [--json]
+  it [--db PATH] db migrate [--to N] [--allow-destructive] [--json]
+  it [--db PATH] db status [--json]
+  it [--db PATH] db down [--to N] [--json]
+  it [--db PATH] db backup --to PATH [--json]
+  it [--db PATH] db restore --from PATH [--json]
+  it [--db PATH] db snapshot [--dir DIR] [--keep N] [--json]
+  it schema
+  it completion bash|zsh|fish
+
+Global flags:
+  --actor NAME   recorded in issue history (default $IT_ACTOR or $USER)
+  --format F     output for show, list, ready, search, tree and view run:
+                 table|csv|yaml|ndjson|json or a Go template like '{{.ID}} {{.Title}}'
 `)
 	if configPath != "" {
 		fmt.Fprintf(os.Stderr, "\nDiscovered itconfig: %s\n", configPath)
@@ -397,6 +1278,40 @@ itconfig format:
 `)
 }
 
+// resolveAssignee maps the "me" shorthand to the current actor.
+func resolveAssignee(svc *issues.Service, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value != "me" {
+		return value, nil
+	}
+	if svc.Actor() == "" {
+		return "", errors.New(`"me" needs an actor; pass --actor or set IT_ACTOR`)
+	}
+	return svc.Actor(), nil
+}
+
+func defaultActor() string {
+	if v := strings.TrimSpace(os.Getenv("IT_ACTOR")); v != "" {
+		return v
+	}
+	return strings.TrimSpace(os.Getenv("USER"))
+}
+
+func readBodyFile(path string) (string, error) {
+	if path == "-" {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("read body from stdin: %w", err)
+		}
+		return string(content), nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read body file: %w", err)
+	}
+	return string(content), nil
+}
+
 func parseCategoryArg(shortValue string) (issues.Category, error) {
 	raw := strings.TrimSpace(strings.ToLower(shortValue))
 	if raw == "" {
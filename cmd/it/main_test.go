@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/satyaki-up/issuetracker/internal/issues"
+)
+
+func TestListFlagsView(t *testing.T) {
+	parse := func(args ...string) *listFlags {
+		fs := flag.NewFlagSet("view save", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		lf := addListFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("parse %v: %v", args, err)
+		}
+		return lf
+	}
+
+	lf := parse("--state", "todo,in_progress", "--label", "area:api,bug", "--assignee", `o"brien`,
+		"--created-after", "7d", "--has-unresolved-deps", "1", "-q", "rate")
+	view, err := lf.view("mine")
+	if err != nil {
+		t.Fatalf("view: %v", err)
+	}
+	want := `state:todo,in_progress assignee:"o\"brien" label:"area:api",bug created>=7d blocked:true rate`
+	if view.Name != "mine" || view.Query != want {
+		t.Fatalf("expected query %q, got %+v", want, view)
+	}
+
+	if _, err := parse("--has-unresolved-deps", "maybe").view("bad"); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for a non-boolean flag, got %v", err)
+	}
+}
+
+func TestQueryValue(t *testing.T) {
+	for in, want := range map[string]string{
+		"todo":       "todo",
+		"":           `""`,
+		"two words":  `"two words"`,
+		"a,b":        `"a,b"`,
+		`say "hi"`:   `"say \"hi\""`,
+		`back\slash`: `"back\\slash"`,
+	} {
+		if got := queryValue(in); got != want {
+			t.Fatalf("queryValue(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// runJSON runs the CLI with args and decodes the envelope it prints.
+func runJSON(t *testing.T, args ...string) (int, envelope, json.RawMessage) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, osArgs := os.Stdout, os.Args
+	os.Stdout, os.Args = w, append([]string{"it"}, args...)
+	code := run()
+	os.Stdout, os.Args = stdout, osArgs
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var env envelope
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(out, &env); err != nil {
+		t.Fatalf("%v: expected a JSON envelope, got %q: %v", args, out, err)
+	}
+	if err := json.Unmarshal(out, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return code, env, raw.Data
+}
+
+func TestJSONEnvelopes(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "issues.db")
+
+	code, env, data := runJSON(t, "--db", dbPath, "create", "--project", "cat", "-c", "p", "--title", "First", "--json")
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &created); err != nil || code != 0 || !env.OK || env.SchemaVersion != jsonSchemaVersion || created.ID != "cat-1" {
+		t.Fatalf("create: exit %d, envelope %+v, data %s", code, env, data)
+	}
+
+	for _, args := range [][]string{{"list"}, {"list", "--limit", "1"}} {
+		code, _, data = runJSON(t, append([]string{"--db", dbPath}, append(args, "--json")...)...)
+		var page issuePage
+		if err := json.Unmarshal(data, &page); err != nil || code != 0 || len(page.Issues) != 1 || page.NextCursor != "" {
+			t.Fatalf("%v: expected an issue page, got exit %d, data %s", args, code, data)
+		}
+	}
+
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"--db", dbPath, "show", "--id", "cat-9", "--json"}, 3, "not_found"},
+		{[]string{"--db", dbPath, "list", "--bogus", "--json"}, 2, "invalid_input"},
+		{[]string{"--db", dbPath, "view", "save", "--json"}, 2, "invalid_input"},
+		{[]string{"--db", dbPath, "comment", "edit", "--json"}, 2, "invalid_input"},
+		{[]string{"--db", dbPath, "label", "--json"}, 2, "invalid_input"},
+		{[]string{"--db", dbPath, "db", "vacuum", "--json"}, 2, "invalid_input"},
+		{[]string{"--db", filepath.Join(blocker, "issues.db"), "list", "--json"}, 1, "internal"},
+	}
+	for _, c := range cases {
+		code, env, _ := runJSON(t, c.args...)
+		if code != c.code || env.OK || env.Error == nil || env.Error.Code != c.want || env.Error.Message == "" {
+			t.Fatalf("%v: expected exit %d with %s, got exit %d and %+v", c.args, c.code, c.want, code, env.Error)
+		}
+	}
+}
+
+func TestSchemaRefsResolve(t *testing.T) {
+	var schema struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if err := json.Unmarshal(jsonSchema, &schema); err != nil {
+		t.Fatalf("schema.json: %v", err)
+	}
+	for _, m := range regexp.MustCompile(`"\$ref": "#/\$defs/(\w+)"`).FindAllSubmatch(jsonSchema, -1) {
+		if _, ok := schema.Defs[string(m[1])]; !ok {
+			t.Errorf("schema.json refers to undefined $defs/%s", m[1])
+		}
+	}
+}
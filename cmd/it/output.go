@@ -0,0 +1,139 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/satyaki-up/issuetracker/internal/issues"
+)
+
+// jsonSchemaVersion is bumped whenever a JSON field is removed, renamed or
+// changes type. Adding fields is not a breaking change.
+const jsonSchemaVersion = 1
+
+// jsonSchema describes the envelope and payload types; see `it schema`.
+//
+//go:embed schema.json
+var jsonSchema []byte
+
+// envelope wraps every --json response.
+type envelope struct {
+	OK            bool       `json:"ok"`
+	SchemaVersion int        `json:"schema_version"`
+	Data          any        `json:"data,omitempty"`
+	Error         *jsonError `json:"error,omitempty"`
+}
+
+type jsonError struct {
+	Code            string   `json:"code"`
+	Message         string   `json:"message"`
+	Field           string   `json:"field,omitempty"`
+	IDs             []string `json:"ids,omitempty"`
+	ExpectedVersion *int64   `json:"expected_version,omitempty"`
+	CurrentVersion  *int64   `json:"current_version,omitempty"`
+}
+
+// exitCodes maps error codes to process exit statuses; anything else exits 1.
+var exitCodes = map[string]int{
+	"invalid_input":            2,
+	"invalid_state_transition": 2,
+	"not_found":                3,
+	"conflict":                 4,
+	"depth_exceeded":           4,
+	"cycle_detected":           4,
+}
+
+// renderError reports err on stderr, or as an error envelope on stdout when
+// jsonOut is set, and returns the exit code for it.
+func renderError(err error, jsonOut bool) int {
+	code := issues.ErrorCode(err)
+	exit, ok := exitCodes[code]
+	if !ok {
+		exit = 1
+	}
+	if jsonOut {
+		je := &jsonError{Code: code, Message: err.Error()}
+		var detail *issues.Error
+		if errors.As(err, &detail) {
+			je.Field = detail.Field
+			je.IDs = detail.IDs
+			je.ExpectedVersion = detail.ExpectedVersion
+			je.CurrentVersion = detail.CurrentVersion
+		}
+		writeJSON(envelope{SchemaVersion: jsonSchemaVersion, Error: je})
+		return exit
+	}
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	return exit
+}
+
+// printJSON writes v as the data of a success envelope.
+func printJSON(v any) {
+	if v == nil {
+		v = struct{}{}
+	}
+	writeJSON(envelope{OK: true, SchemaVersion: jsonSchemaVersion, Data: v})
+}
+
+func writeJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+// usageError reports a malformed command line as invalid input.
+func usageError(jsonOut bool, format string, args ...any) int {
+	return renderError(fmt.Errorf("%w: %s", issues.ErrInvalidInput, fmt.Sprintf(format, args...)), jsonOut)
+}
+
+// parseFlags parses a command's flags. A bad flag is reported as invalid
+// input, followed by the usage unless args ask for JSON, and ok is false.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	fs.SetOutput(os.Stderr)
+	switch {
+	case err == nil:
+		return 0, true
+	case errors.Is(err, flag.ErrHelp):
+		fs.Usage()
+		return 0, false
+	}
+	jsonOut := jsonRequested(args)
+	code = usageError(jsonOut, "%v", err)
+	if !jsonOut {
+		fs.Usage()
+	}
+	return code, false
+}
+
+// jsonRequested reports whether args ask for --json, so that errors found
+// before a command has parsed its flags match the output it would give.
+func jsonRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "json" {
+			continue
+		}
+		if !hasValue {
+			return true
+		}
+		v, err := strconv.ParseBool(value)
+		return err == nil && v
+	}
+	return false
+}
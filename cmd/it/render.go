@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/satyaki-up/issuetracker/internal/issues"
+)
+
+// renderer prints the default human-readable output: aligned columns,
+// titles truncated to the terminal width, and colored states when stdout is
+// a terminal, and tab-separated columns otherwise.
+type renderer struct {
+	tty   bool
+	color bool
+	width int // 0 means do not truncate
+
+	// unresolved lists the blocked_by entries that are not done, per issue.
+	unresolved map[string][]string
+}
+
+var stateColors = map[issues.State]string{
+	issues.StateTodo:       "36", // cyan
+	issues.StateInProgress: "33", // yellow
+	issues.StateBlocked:    "31", // red
+	issues.StateDone:       "32", // green
+	issues.StateCanceled:   "90", // gray
+}
+
+const (
+	unresolvedMark  = "!"
+	unresolvedColor = "1;31" // bold red
+	minTitleWidth   = 10
+)
+
+// newRenderer styles output for stdout. Columns are aligned and titles
+// truncated only on a terminal; color also needs NO_COLOR unset and TERM not
+// dumb.
+func newRenderer(unresolved map[string][]string) renderer {
+	r := renderer{unresolved: unresolved}
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return r
+	}
+	r.tty = true
+	r.color = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	r.width = terminalWidth()
+	return r
+}
+
+// rendererFor looks up which of the listed issues still have unresolved
+// dependencies so they can be marked.
+func rendererFor(ctx context.Context, svc *issues.Service, list []issues.Issue) (renderer, error) {
+	ids := make([]string, 0, len(list))
+	for _, is := range list {
+		if len(is.BlockedBy) > 0 {
+			ids = append(ids, is.ID)
+		}
+	}
+	unresolved, err := svc.UnresolvedDependencies(ctx, ids)
+	if err != nil {
+		return renderer{}, err
+	}
+	return newRenderer(unresolved), nil
+}
+
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	if n := ttyWidth(os.Stdout.Fd()); n > 0 {
+		return n
+	}
+	return 80
+}
+
+func (r renderer) paint(code, s string) string {
+	if !r.color || code == "" || s == "" {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// cell is one table entry; color applies after padding so escape codes
+// never affect alignment.
+type cell struct {
+	text  string
+	color string
+}
+
+func (r renderer) stateCell(st issues.State) cell {
+	return cell{text: string(st), color: stateColors[st]}
+}
+
+func (r renderer) markCell(id string) cell {
+	if len(r.unresolved[id]) == 0 {
+		return cell{}
+	}
+	return cell{text: unresolvedMark, color: unresolvedColor}
+}
+
+// table prints rows. See tableLines.
+func (r renderer) table(rows [][]cell, flex int) {
+	for _, line := range r.tableLines(rows, flex) {
+		fmt.Println(line)
+	}
+}
+
+// tableLines lays rows out. On a terminal, columns are aligned and separated
+// by two spaces, columns that are empty in every row are dropped, and the
+// flex column is truncated so each line fits the width. Otherwise every
+// column is kept, untruncated, and separated by a tab, so the layout does not
+// depend on the rows.
+func (r renderer) tableLines(rows [][]cell, flex int) []string {
+	if len(rows) == 0 {
+		return nil
+	}
+	if !r.tty {
+		lines := make([]string, 0, len(rows))
+		for _, row := range rows {
+			texts := make([]string, len(row))
+			for i, c := range row {
+				texts[i] = c.text
+			}
+			lines = append(lines, strings.Join(texts, "\t"))
+		}
+		return lines
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, c := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(c.text))
+		}
+	}
+	if r.width > 0 {
+		used := 0
+		visible := 0
+		for i, w := range widths {
+			if w == 0 {
+				continue
+			}
+			visible++
+			if i != flex {
+				used += w
+			}
+		}
+		avail := r.width - used - 2*(visible-1)
+		if widths[flex] > avail {
+			widths[flex] = max(avail, minTitleWidth)
+		}
+	}
+
+	last := len(widths) - 1
+	for last > 0 && widths[last] == 0 {
+		last--
+	}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		var b strings.Builder
+		sep := ""
+		for i, c := range row {
+			if widths[i] == 0 || i > last {
+				continue
+			}
+			text := truncate(c.text, widths[i])
+			b.WriteString(sep)
+			b.WriteString(r.paint(c.color, text))
+			if i < last {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(text)))
+			}
+			sep = "  "
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+	return lines
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string([]rune(s)[:width])
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+func (r renderer) issueRow(prefix string, is issues.Issue) []cell {
+	return []cell{
+		{text: prefix + is.ID},
+		{text: string(is.Category)},
+		r.stateCell(is.State),
+		r.markCell(is.ID),
+		{text: fmt.Sprintf("v%d", is.Version)},
+		{text: is.Title},
+		{text: strings.Join(is.Labels, ",")},
+	}
+}
+
+const titleColumn = 5
+
+func (r renderer) issueList(list []issues.Issue) {
+	rows := make([][]cell, 0, len(list))
+	for _, is := range list {
+		rows = append(rows, r.issueRow("", is))
+	}
+	r.table(rows, titleColumn)
+}
+
+func (r renderer) tree(tree []issues.TreeNode) {
+	var rows [][]cell
+	var walk func(node issues.TreeNode, level int)
+	walk = func(node issues.TreeNode, level int) {
+		rows = append(rows, r.issueRow(strings.Repeat("  ", level)+"- ", node.Issue))
+		for _, child := range node.Children {
+			walk(child, level+1)
+		}
+	}
+	for _, node := range tree {
+		walk(node, 0)
+	}
+	r.table(rows, titleColumn)
+}
+
+// issue prints every field of one issue as aligned "key: value" lines.
+func (r renderer) issue(is issues.Issue) {
+	type field struct {
+		key   string
+		value string
+		color string
+	}
+	fields := []field{
+		{key: "id", value: is.ID},
+		{key: "project", value: is.ProjectPrefix},
+		{key: "category", value: string(is.Category)},
+		{key: "state", value: string(is.State), color: stateColors[is.State]},
+	}
+	if is.Assignee != nil {
+		fields = append(fields, field{key: "assignee", value: *is.Assignee})
+	}
+	if is.BlockedReason != nil {
+		fields = append(fields, field{key: "blocked_reason", value: *is.BlockedReason})
+	}
+	fields = append(fields, field{key: "version", value: strconv.FormatInt(is.Version, 10)})
+	if is.ParentID != nil {
+		fields = append(fields, field{key: "parent", value: *is.ParentID})
+	}
+	fields = append(fields, field{key: "title", value: is.Title})
+	if is.Body != "" {
+		fields = append(fields, field{key: "body", value: is.Body})
+	}
+	if len(is.BlockedBy) > 0 {
+		fields = append(fields, field{key: "blocked_by", value: strings.Join(is.BlockedBy, ",")})
+	}
+	if unresolved := r.unresolved[is.ID]; len(unresolved) > 0 {
+		fields = append(fields, field{key: "unresolved", value: strings.Join(unresolved, ","), color: unresolvedColor})
+	}
+	if len(is.Blocks) > 0 {
+		fields = append(fields, field{key: "blocks", value: strings.Join(is.Blocks, ",")})
+	}
+	if len(is.Labels) > 0 {
+		fields = append(fields, field{key: "labels", value: strings.Join(is.Labels, ",")})
+	}
+	fields = append(fields,
+		field{key: "created_at", value: is.CreatedAt.Format(time.RFC3339)},
+		field{key: "last_updated_at", value: is.LastUpdatedAt.Format(time.RFC3339)},
+	)
+	if is.ClosedAt != nil {
+		fields = append(fields, field{key: "closed_at", value: is.ClosedAt.Format(time.RFC3339)})
+	}
+	if is.ArchivedAt != nil {
+		fields = append(fields, field{key: "archived_at", value: is.ArchivedAt.Format(time.RFC3339)})
+	}
+
+	width := 0
+	for _, f := range fields {
+		width = max(width, len(f.key))
+	}
+	for _, f := range fields {
+		fmt.Printf("%s:%s %s\n", f.key, strings.Repeat(" ", width-len(f.key)), r.paint(f.color, f.value))
+	}
+	if len(is.Comments) > 0 {
+		fmt.Println("comments:")
+		for _, c := range is.Comments {
+			fmt.Print("  ")
+			printComment(c)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a longer title", 8, "a longe…"},
+		{"héllo wörld", 6, "héllo…"},
+	}
+	for _, c := range cases {
+		if got := truncate(c.in, c.width); got != c.want {
+			t.Fatalf("truncate(%q, %d) = %q, want %q", c.in, c.width, got, c.want)
+		}
+	}
+}
+
+func TestPaint(t *testing.T) {
+	plain := renderer{}
+	if got := plain.paint("31", "blocked"); got != "blocked" {
+		t.Fatalf("paint without color = %q", got)
+	}
+	colored := renderer{color: true}
+	if got := colored.paint("31", "blocked"); got != "\x1b[31mblocked\x1b[0m" {
+		t.Fatalf("paint with color = %q", got)
+	}
+	if got := colored.paint("", "todo"); got != "todo" {
+		t.Fatalf("paint without code = %q", got)
+	}
+}
+
+func TestTableLines(t *testing.T) {
+	rows := [][]cell{
+		{{text: "cat-1"}, {text: ""}, {text: "a long title"}},
+		{{text: "cat-12"}, {text: ""}, {text: "short"}},
+	}
+	piped := renderer{}
+	if got := strings.Join(piped.tableLines(rows, 2), "\n"); got != "cat-1\t\ta long title\ncat-12\t\tshort" {
+		t.Fatalf("piped table = %q", got)
+	}
+	term := renderer{tty: true, width: 18}
+	if got := strings.Join(term.tableLines(rows, 2), "\n"); got != "cat-1   a long ti…\ncat-12  short" {
+		t.Fatalf("terminal table = %q", got)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// ttyWidth is unknown off unix; callers fall back to $COLUMNS or 80.
+func ttyWidth(fd uintptr) int { return 0 }
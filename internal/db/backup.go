@@ -0,0 +1,412 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mainFile returns the path of the main database file, or "" for an
+// in-memory database.
+func mainFile(ctx context.Context, db *sql.DB) (string, error) {
+	rows, err := db.QueryContext(ctx, `PRAGMA database_list`)
+	if err != nil {
+		return "", fmt.Errorf("list databases: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return "", fmt.Errorf("scan database list: %w", err)
+		}
+		if name == "main" {
+			return file, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// vacuumInto writes a consistent, compacted copy of the database to dest,
+// which must not exist yet.
+func vacuumInto(ctx context.Context, db *sql.DB, dest string) error {
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		return fmt.Errorf("back up to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// autoBackup copies the database next to itself before a migration step
+// that rebuilds or drops a table. One backup covers a whole migration run.
+func autoBackup(ctx context.Context, db *sql.DB, report *MigrationReport) error {
+	if report.Backup != "" {
+		return nil
+	}
+	path, err := mainFile(ctx, db)
+	if err != nil || path == "" {
+		return err
+	}
+	dest := backupName(path)
+	if err := vacuumInto(ctx, db, dest); err != nil {
+		return err
+	}
+	report.Backup = dest
+	return nil
+}
+
+// backupIfData takes an automatic backup unless the database has no issues
+// yet, as when a new database is migrated from scratch.
+func backupIfData(ctx context.Context, db *sql.DB, report *MigrationReport) error {
+	var hasData bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM issues)`).Scan(&hasData); err != nil {
+		return fmt.Errorf("count issues: %w", err)
+	}
+	if !hasData {
+		return nil
+	}
+	return autoBackup(ctx, db, report)
+}
+
+// backupName picks an unused <path>.backup-<UTC timestamp> file name.
+func backupName(path string) string {
+	stamp := fmt.Sprintf("%s.backup-%s", path, time.Now().UTC().Format("20060102T150405Z"))
+	name := stamp
+	for n := 2; fileExists(name); n++ {
+		name = fmt.Sprintf("%s-%d", stamp, n)
+	}
+	return name
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+var (
+	// ErrIntegrity is returned when a database file fails verification.
+	ErrIntegrity = errors.New("database failed integrity check")
+	// ErrInUse is returned when a database cannot be replaced because
+	// another connection has it open.
+	ErrInUse = errors.New("database is in use")
+)
+
+// Backup writes a consistent copy of the open database to dest with
+// VACUUM INTO, which is safe while other connections are writing, and
+// verifies the copy. A copy that fails verification is removed.
+func Backup(ctx context.Context, db *sql.DB, dest string) error {
+	if fileExists(dest) {
+		return fmt.Errorf("backup target %s already exists", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("create backup dir: %w", err)
+	}
+	if err := vacuumInto(ctx, db, dest); err != nil {
+		return err
+	}
+	if err := Verify(ctx, dest); err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+// Verify checks that path is an intact issue database this binary can
+// open: PRAGMA integrity_check and foreign_key_check pass, it has an issues
+// table, and its schema is not newer than this binary.
+func Verify(ctx context.Context, path string) error {
+	if !fileExists(path) {
+		return fmt.Errorf("%s does not exist", path)
+	}
+	db, err := sql.Open("sqlite", readOnlyDSN(path))
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIntegrity, path, err)
+	}
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return fmt.Errorf("%w: %s: %v", ErrIntegrity, path, err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIntegrity, path, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrIntegrity, path, strings.Join(problems, "; "))
+	}
+
+	var violations int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM pragma_foreign_key_check`).Scan(&violations); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIntegrity, path, err)
+	}
+	if violations > 0 {
+		return fmt.Errorf("%w: %s: %d foreign key violation(s)", ErrIntegrity, path, violations)
+	}
+
+	var hasIssues int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = 'issues'`).Scan(&hasIssues); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIntegrity, path, err)
+	}
+	if hasIssues == 0 {
+		return fmt.Errorf("%w: %s has no issues table", ErrIntegrity, path)
+	}
+	return checkSchemaVersion(ctx, db)
+}
+
+// readOnlyDSN opens path read-only so verifying a file never changes it.
+func readOnlyDSN(path string) string {
+	return fileURI(path) + "?mode=ro"
+}
+
+// Restore verifies src and replaces the database file at dest with a copy
+// of it. An existing dest is kept next to itself as <dest>.backup-<UTC
+// timestamp>, whose path is returned. Restore fails with ErrInUse while
+// another connection has dest open.
+func Restore(ctx context.Context, src, dest string) (string, error) {
+	if err := Verify(ctx, src); err != nil {
+		return "", err
+	}
+	if same, err := sameFile(src, dest); err != nil || same {
+		if err == nil {
+			err = fmt.Errorf("cannot restore %s onto itself", dest)
+		}
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("create db dir: %w", err)
+	}
+
+	// Copy through SQLite rather than the file system so a source that is
+	// itself in WAL mode is read consistently.
+	tmp := dest + ".restore-tmp"
+	_ = os.Remove(tmp)
+	srcDB, err := sql.Open("sqlite", readOnlyDSN(src))
+	if err != nil {
+		return "", fmt.Errorf("open %s: %w", src, err)
+	}
+	err = vacuumInto(ctx, srcDB, tmp)
+	srcDB.Close()
+	if err != nil {
+		return "", err
+	}
+	if err := Verify(ctx, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+
+	// dest keeps its name until the verified copy replaces it in a single
+	// rename, so no process can find it missing and create an empty
+	// database in its place. Until then it is locked against every other
+	// connection, and the file kept as the backup is a hard link to it.
+	var saved string
+	if fileExists(dest) {
+		saved = backupName(dest)
+		unlock, err := lockForRestore(ctx, dest, saved)
+		if err != nil {
+			_ = os.Remove(tmp)
+			return "", err
+		}
+		defer unlock()
+		if err := os.Link(dest, saved); err != nil {
+			_ = os.Remove(tmp)
+			return "", fmt.Errorf("keep %s as %s: %w", dest, saved, err)
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		if saved != "" {
+			_ = os.Remove(saved)
+		}
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("replace %s: %w", dest, err)
+	}
+	return saved, nil
+}
+
+// lockForRestore prepares the database at path to be replaced and holds an
+// exclusive lock on it until the returned function is called. In exclusive
+// locking mode the lock covers the database file itself, so taking it fails
+// with ErrInUse while any other connection has the database open, and no
+// connection can open it meanwhile.
+//
+// Under the lock the database switches to a rollback journal, which folds
+// its WAL into the main file and removes it, so the main file alone is a
+// complete backup and no stale WAL is left to be replayed onto the restored
+// copy. A damaged database whose WAL cannot be folded in, or a file that is
+// not a database at all, has its -wal and -shm files moved to saved-wal and
+// saved-shm instead.
+func lockForRestore(ctx context.Context, path, saved string) (func(), error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	unlock := func() { db.Close() }
+	conn, err := db.Conn(ctx)
+	if err == nil {
+		unlock = func() {
+			conn.Close()
+			db.Close()
+		}
+		for _, stmt := range []string{"PRAGMA busy_timeout = 1000", "PRAGMA locking_mode = EXCLUSIVE", "BEGIN EXCLUSIVE"} {
+			if _, err = conn.ExecContext(ctx, stmt); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		unlock()
+		if hasSQLiteHeader(path) {
+			return nil, fmt.Errorf("%w: %s is open elsewhere; stop other it processes first", ErrInUse, path)
+		}
+		return func() {}, moveSideFiles(path, saved)
+	}
+
+	// The lock outlives the transaction in exclusive locking mode.
+	for _, stmt := range []string{"COMMIT", "PRAGMA journal_mode = DELETE"} {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = os.Remove(path + "-shm")
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	} else {
+		err = moveSideFiles(path, saved)
+	}
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// moveSideFiles moves the -wal and -shm files of path next to saved. If
+// one cannot be moved, those already moved are put back.
+func moveSideFiles(path, saved string) error {
+	var moved []string
+	for _, suffix := range []string{"-wal", "-shm"} {
+		err := os.Rename(path+suffix, saved+suffix)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			for _, back := range moved {
+				_ = os.Rename(saved+back, path+back)
+			}
+			return fmt.Errorf("move %s aside: %w", path+suffix, err)
+		}
+		moved = append(moved, suffix)
+	}
+	return nil
+}
+
+func hasSQLiteHeader(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 16)
+	_, err = io.ReadFull(f, header)
+	return err == nil && string(header) == "SQLite format 3\x00"
+}
+
+func sameFile(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ai, bi), nil
+}
+
+const snapshotLayout = "20060102T150405.000Z"
+
+// Snapshot backs the database up into dir as <name>-<UTC timestamp>.db,
+// named after the database file, then deletes the oldest snapshots beyond
+// keep (0 keeps all). It returns the new snapshot and the removed ones.
+func Snapshot(ctx context.Context, db *sql.DB, dir string, keep int) (string, []string, error) {
+	path, err := mainFile(ctx, db)
+	if err != nil {
+		return "", nil, err
+	}
+	if path == "" {
+		return "", nil, errors.New("cannot snapshot an in-memory database")
+	}
+	prefix := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "-"
+	// Snapshots taken within the same millisecond move forward so names
+	// stay unique and ordered.
+	stamp := time.Now().UTC()
+	dest := filepath.Join(dir, prefix+stamp.Format(snapshotLayout)+".db")
+	for fileExists(dest) {
+		stamp = stamp.Add(time.Millisecond)
+		dest = filepath.Join(dir, prefix+stamp.Format(snapshotLayout)+".db")
+	}
+	if err := Backup(ctx, db, dest); err != nil {
+		return "", nil, err
+	}
+
+	snapshots, err := Snapshots(dir, prefix)
+	if err != nil || keep <= 0 || len(snapshots) <= keep {
+		return dest, nil, err
+	}
+	var removed []string
+	for _, old := range snapshots[:len(snapshots)-keep] {
+		if err := os.Remove(old); err != nil {
+			return dest, removed, fmt.Errorf("remove old snapshot: %w", err)
+		}
+		removed = append(removed, old)
+	}
+	return dest, removed, nil
+}
+
+// Snapshots lists the snapshots in dir whose names start with prefix,
+// oldest first.
+func Snapshots(dir, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read snapshot dir: %w", err)
+	}
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		if _, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".db")); err != nil {
+			continue
+		}
+		out = append(out, filepath.Join(dir, name))
+	}
+	// The timestamp layout sorts chronologically.
+	sort.Strings(out)
+	return out, nil
+}
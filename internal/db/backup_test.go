@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	database, path := openRaw(t)
+	if err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO issues(id, category, title, state) VALUES ('IT-1', 'task', 'kept', 'todo')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "nested", "backup.db")
+	if err := Backup(ctx, database, dest); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if err := Backup(ctx, database, dest); err == nil {
+		t.Fatal("expected backup onto an existing file to fail")
+	}
+
+	if _, err := database.Exec(`DELETE FROM issues`); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := Restore(ctx, dest, path); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected restore over an open database to fail, got %v", err)
+	}
+	if err := database.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	saved, err := Restore(ctx, dest, path)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if saved == "" || !fileExists(saved) {
+		t.Fatalf("expected previous database to be kept, got %q", saved)
+	}
+	if _, err := Restore(ctx, path, path); err == nil {
+		t.Fatal("expected restoring a database onto itself to fail")
+	}
+
+	restored, err := Open(ctx, path)
+	if err != nil {
+		t.Fatalf("open restored: %v", err)
+	}
+	defer restored.Close()
+	var title string
+	if err := restored.QueryRow(`SELECT title FROM issues WHERE id = 'IT-1'`).Scan(&title); err != nil || title != "kept" {
+		t.Fatalf("expected restored issue, got %q, %v", title, err)
+	}
+}
+
+func TestVerifyRejectsBadFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database at all, just some text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ctx, garbage); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected integrity error for a non-database file, got %v", err)
+	}
+
+	other, otherPath := openRaw(t)
+	if _, err := other.Exec(`CREATE TABLE notes (body TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ctx, otherPath); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected integrity error for a database without issues, got %v", err)
+	}
+	copied := filepath.Join(dir, "copy.db")
+	if err := Backup(ctx, other, copied); !errors.Is(err, ErrIntegrity) || fileExists(copied) {
+		t.Fatalf("expected a backup failing verification to be removed, got %v", err)
+	}
+
+	target, targetPath := openRaw(t)
+	if err := Migrate(ctx, target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, garbage, targetPath); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected restore of a bad file to fail, got %v", err)
+	}
+	if !fileExists(targetPath) {
+		t.Fatal("failed restore must leave the database in place")
+	}
+
+	if err := target.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, targetPath, garbage); err != nil {
+		t.Fatalf("expected a damaged database to be replaced, got %v", err)
+	}
+	if err := Verify(ctx, garbage); err != nil {
+		t.Fatalf("expected the restored copy in place of the damaged file, got %v", err)
+	}
+}
+
+func TestSnapshotRotation(t *testing.T) {
+	ctx := context.Background()
+	database, _ := openRaw(t)
+	if err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	var created []string
+	for i := 0; i < 3; i++ {
+		path, removed, err := Snapshot(ctx, database, dir, 2)
+		if err != nil {
+			t.Fatalf("snapshot %d: %v", i, err)
+		}
+		created = append(created, path)
+		if i < 2 && len(removed) != 0 {
+			t.Fatalf("snapshot %d removed %v", i, removed)
+		}
+		if i == 2 && (len(removed) != 1 || removed[0] != created[0]) {
+			t.Fatalf("expected oldest snapshot removed, got %v", removed)
+		}
+	}
+
+	left, err := Snapshots(dir, "issues-")
+	if err != nil {
+		t.Fatalf("list snapshots: %v", err)
+	}
+	if len(left) != 2 || left[0] != created[1] || left[1] != created[2] {
+		t.Fatalf("unexpected snapshots left: %v", left)
+	}
+}
+
+func TestRestoreKeepsUncheckpointedWrites(t *testing.T) {
+	ctx := context.Background()
+	database, path := openRaw(t)
+	if err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO issues(id, category, title, state) VALUES ('IT-1', 'project', 'backed up', 'todo')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	backup := filepath.Join(t.TempDir(), "backup.db")
+	if err := Backup(ctx, database, backup); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if _, err := database.Exec(`INSERT INTO issues(id, category, title, state) VALUES ('IT-2', 'project', 'only in the WAL', 'todo')`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	// Copy the files while the connection is open, as a crashed process
+	// would leave them: the last write is only in the WAL.
+	crashed := filepath.Join(t.TempDir(), "issues.db")
+	for _, suffix := range []string{"", "-wal"} {
+		content, err := os.ReadFile(path + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(crashed+suffix, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := Restore(ctx, backup, crashed)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if fileExists(crashed + "-wal") {
+		t.Fatal("expected no WAL left next to the restored database")
+	}
+	count := func(path string) int {
+		t.Helper()
+		db, err := sql.Open("sqlite", readOnlyDSN(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(1) FROM issues`).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", path, err)
+		}
+		return n
+	}
+	if n := count(saved); n != 2 {
+		t.Fatalf("expected the kept database to include the WAL write, got %d issues", n)
+	}
+	if n := count(crashed); n != 1 {
+		t.Fatalf("expected the restored database, got %d issues", n)
+	}
+}
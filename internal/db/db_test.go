@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestConnectAppliesPragmasToEveryConnection(t *testing.T) {
+	ctx := context.Background()
+	database, _ := openRaw(t)
+
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := database.Conn(ctx)
+		if err != nil {
+			t.Fatalf("conn %d: %v", i, err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for i, conn := range conns {
+		var foreignKeys, busyTimeout int
+		if err := conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&foreignKeys); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&busyTimeout); err != nil {
+			t.Fatal(err)
+		}
+		if foreignKeys != 1 || busyTimeout != 5000 {
+			t.Fatalf("conn %d: foreign_keys=%d busy_timeout=%d", i, foreignKeys, busyTimeout)
+		}
+	}
+}
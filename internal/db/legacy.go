@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Databases created before versioned migrations may have an older issues
+// table and tables this binary no longer uses. Adopting them must not lose
+// data unless the caller opts in with MigrateOptions.AllowDestructive.
+
+// baselineIssueColumns is the issues table migration 1 expects.
+var baselineIssueColumns = []string{
+	"id", "category", "title", "body", "state", "parent_id", "version", "blocked_by", "blocked_reason", "created_at", "last_updated_at", "closed_at", "archived_at", "assignee",
+}
+
+// legacyTables are no longer used; dropping them is destructive.
+var legacyTables = []string{"issue_state_history", "projects"}
+
+type columnInfo struct {
+	notNull    bool
+	hasDefault bool
+}
+
+func issueColumns(ctx context.Context, db *sql.DB) (map[string]columnInfo, error) {
+	if exists, err := tableExists(ctx, db, "issues"); err != nil || !exists {
+		return map[string]columnInfo{}, err
+	}
+
+	rows, err := db.QueryContext(ctx, `PRAGMA table_info(issues)`)
+	if err != nil {
+		return nil, fmt.Errorf("inspect issues table: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]columnInfo)
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notNull int
+		var dflt sql.NullString
+		var pk int
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return nil, fmt.Errorf("scan table info: %w", err)
+		}
+		columns[name] = columnInfo{notNull: notNull != 0, hasDefault: dflt.Valid}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read table info: %w", err)
+	}
+	return columns, nil
+}
+
+func tableExists(ctx context.Context, db *sql.DB, name string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("inspect %s table: %w", name, err)
+	}
+	return n > 0, nil
+}
+
+// ensureIssuesTableMinimalShape rebuilds a legacy issues table that lacks
+// baseline columns, or has extra NOT NULL columns that would reject inserts.
+// Other extra columns are left alone. A rebuild that would discard a column
+// is refused unless opts.AllowDestructive is set, and a backup is taken
+// before any rebuild.
+func ensureIssuesTableMinimalShape(ctx context.Context, db *sql.DB, opts MigrateOptions, report *MigrationReport) error {
+	columns, err := issueColumns(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	_, _ = db.ExecContext(ctx, `DROP TRIGGER IF EXISTS trg_issues_updated_at`)
+
+	baseline := make(map[string]bool, len(baselineIssueColumns))
+	var missing []string
+	for _, c := range baselineIssueColumns {
+		baseline[c] = true
+		if _, ok := columns[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	var blocking []string
+	for name, info := range columns {
+		if !baseline[name] && info.notNull && !info.hasDefault {
+			blocking = append(blocking, name)
+		}
+	}
+	if len(missing) == 0 && len(blocking) == 0 {
+		return nil
+	}
+
+	has := func(c string) bool { _, ok := columns[c]; return ok }
+	carried := make(map[string]bool)
+	expr := func(column, fallback string, sources ...string) string {
+		for _, src := range append([]string{column}, sources...) {
+			if has(src) {
+				carried[src] = true
+				return src
+			}
+		}
+		return fallback
+	}
+
+	categoryExpr := expr("category", "'task'")
+	bodyExpr := expr("body", "''")
+	stateExpr := expr("state", "'todo'")
+	parentExpr := expr("parent_id", "NULL")
+	versionExpr := expr("version", "1")
+	blockedByExpr := expr("blocked_by", "'[]'")
+	blockedReasonExpr := expr("blocked_reason", "NULL")
+	createdExpr := expr("created_at", "CURRENT_TIMESTAMP")
+	lastUpdatedExpr := expr("last_updated_at", "CURRENT_TIMESTAMP", "updated_at", "created_at")
+	closedExpr := expr("closed_at", "NULL")
+	archivedExpr := expr("archived_at", "NULL")
+	assigneeExpr := expr("assignee", "NULL")
+
+	var dropped []string
+	for name := range columns {
+		if !baseline[name] && !carried[name] {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(dropped)
+	if len(dropped) > 0 && !opts.AllowDestructive {
+		return fmt.Errorf("%w: rebuilding the issues table would drop column(s) %s; run `it db migrate --allow-destructive` to allow it (a backup is taken first)", ErrDestructiveMigration, strings.Join(dropped, ", "))
+	}
+	if err := autoBackup(ctx, db, report); err != nil {
+		return err
+	}
+
+	stmts := []string{
+		"PRAGMA foreign_keys = OFF",
+		"BEGIN IMMEDIATE",
+		`CREATE TABLE issues_new (
+			id TEXT PRIMARY KEY,
+			category TEXT NOT NULL,
+			title TEXT NOT NULL,
+			body TEXT NOT NULL DEFAULT '',
+			state TEXT NOT NULL,
+			parent_id TEXT,
+			version INTEGER NOT NULL DEFAULT 1,
+			blocked_by TEXT NOT NULL DEFAULT '[]',
+			blocked_reason TEXT,
+			created_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP),
+			last_updated_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP),
+			closed_at TEXT,
+			archived_at TEXT,
+			assignee TEXT,
+			FOREIGN KEY (parent_id) REFERENCES issues_new(id) ON DELETE SET NULL
+		)`,
+		fmt.Sprintf(`
+			INSERT INTO issues_new(
+				id, category, title, body, state, parent_id, version, blocked_by, blocked_reason, created_at, last_updated_at, closed_at, archived_at, assignee
+			)
+			SELECT
+				id,
+				%s,
+				title,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s,
+				%s
+			FROM issues
+		`, categoryExpr, bodyExpr, stateExpr, parentExpr, versionExpr, blockedByExpr, blockedReasonExpr, createdExpr, lastUpdatedExpr, closedExpr, archivedExpr, assigneeExpr),
+		"DROP TABLE issues",
+		"ALTER TABLE issues_new RENAME TO issues",
+		"COMMIT",
+		"PRAGMA foreign_keys = ON",
+	}
+
+	// PRAGMA foreign_keys is per connection, so the rebuild needs one.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			_, _ = conn.ExecContext(ctx, "ROLLBACK")
+			_, _ = conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+			return fmt.Errorf("migrate issues table to minimal shape: %w", err)
+		}
+	}
+
+	change := "rebuilt issues table"
+	if len(missing) > 0 {
+		change += "; added " + strings.Join(missing, ", ")
+	}
+	if len(dropped) > 0 {
+		change += "; dropped " + strings.Join(dropped, ", ")
+	}
+	report.Changes = append(report.Changes, change)
+	return nil
+}
+
+// dropLegacyTables drops tables this binary no longer uses when the caller
+// allows it, and otherwise reports that they were kept.
+func dropLegacyTables(ctx context.Context, db *sql.DB, opts MigrateOptions, report *MigrationReport) error {
+	var present []string
+	for _, name := range legacyTables {
+		exists, err := tableExists(ctx, db, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			present = append(present, name)
+		}
+	}
+	if len(present) == 0 {
+		return nil
+	}
+	if !opts.AllowDestructive {
+		report.Changes = append(report.Changes, fmt.Sprintf("kept unused legacy table(s) %s; `it db migrate --allow-destructive` drops them", strings.Join(present, ", ")))
+		return nil
+	}
+
+	if err := autoBackup(ctx, db, report); err != nil {
+		return err
+	}
+	for _, name := range present {
+		if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS `+name); err != nil {
+			return fmt.Errorf("drop legacy table: %w", err)
+		}
+		report.Changes = append(report.Changes, "dropped legacy table "+name)
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+var (
+	// ErrSchemaTooNew is returned for a database migrated by a newer binary.
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+	// ErrBadTarget is returned for a migrate or rollback target that cannot
+	// be reached.
+	ErrBadTarget = errors.New("invalid schema version target")
+	// ErrDestructiveMigration is returned when adopting a legacy database
+	// would lose data and MigrateOptions.AllowDestructive is not set.
+	ErrDestructiveMigration = errors.New("migration would drop data")
+)
+
+// MigrateOptions controls how a database is brought up to date.
+type MigrateOptions struct {
+	// AllowDestructive lets migration drop legacy tables and issues
+	// columns this binary does not know.
+	AllowDestructive bool
+}
+
+// MigrationReport describes what a migration or rollback run changed.
+type MigrationReport struct {
+	Applied  []Migration
+	Reverted []Migration
+	// Backup is the copy taken before a table was rebuilt or dropped.
+	Backup string
+	// Changes lists changes to legacy tables, legacy tables left alone, and
+	// data a migration could not carry over.
+	Changes []string
+}
+
+// Migration is one numbered schema change. Files are named
+// NNNN_name.up.sql with an optional NNNN_name.down.sql; a migration
+// without a down file cannot be rolled back.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+func (m Migration) Reversible() bool { return m.down != "" }
+
+func (m Migration) String() string { return fmt.Sprintf("%04d_%s", m.Version, m.Name) }
+
+var migrationFileRe = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var dropRe = regexp.MustCompile(`(?i)\bDROP\s+(TABLE|COLUMN)\b`)
+
+// drops reports whether script drops a table or column, and so needs a
+// backup first.
+func drops(script string) bool { return dropRe.MatchString(script) }
+
+// migrationLosses describe, for migrations that cannot carry every existing
+// value over, what they will drop. Each runs in the migration's transaction
+// just before its script.
+var migrationLosses = map[int]func(context.Context, *sql.Conn) ([]string, error){
+	8: droppedDependencies,
+}
+
+// droppedDependencies lists the blocked_by values that 0008 does not copy
+// into issue_dependencies: lists that are not JSON arrays, and entries that
+// are not the ID of another existing issue.
+func droppedDependencies(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, blocked_by, 1, -1
+		FROM issues
+		WHERE blocked_by != '' AND NOT (json_valid(blocked_by) AND json_type(blocked_by) = 'array')
+		UNION ALL
+		SELECT i.id, COALESCE(CAST(d.value AS TEXT), 'null'), 0, d.key
+		FROM issues i
+		JOIN json_each(CASE WHEN json_valid(i.blocked_by) AND json_type(i.blocked_by) = 'array' THEN i.blocked_by ELSE '[]' END) d
+		WHERE d.type != 'text' OR lower(trim(d.value)) = i.id
+			OR NOT EXISTS (SELECT 1 FROM issues dep WHERE dep.id = lower(trim(d.value)))
+		ORDER BY 1, 4
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("find unmigratable blocked_by entries: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id, value string
+		var whole bool
+		var key int
+		if err := rows.Scan(&id, &value, &whole, &key); err != nil {
+			return nil, err
+		}
+		if whole {
+			out = append(out, fmt.Sprintf("dropped blocked_by of %s: %q is not a JSON list", id, value))
+		} else {
+			out = append(out, fmt.Sprintf("dropped blocked_by entry %q of %s: not the ID of another issue", value, id))
+		}
+	}
+	return out, rows.Err()
+}
+
+var migrations = mustLoadMigrations()
+
+func mustLoadMigrations() []Migration {
+	ms, err := loadMigrations(migrationFS)
+	if err != nil {
+		panic(err)
+	}
+	return ms
+}
+
+// loadMigrations reads the migration files, which must be numbered 1..N
+// without gaps and each have an up file.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		content, err := fs.ReadFile(fsys, "migrations/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(content)
+		} else {
+			mig.down = string(content)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+	}
+	return out, nil
+}
+
+// Migrations returns every migration this binary knows, oldest first.
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// LatestVersion is the schema version this binary migrates to.
+func LatestVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion reads PRAGMA user_version, which tracks the last applied
+// migration.
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var v int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return v, nil
+}
+
+func checkSchemaVersion(ctx context.Context, db *sql.DB) error {
+	v, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if v > LatestVersion() {
+		return fmt.Errorf("%w: database is at version %d, this binary supports up to %d; upgrade it", ErrSchemaTooNew, v, LatestVersion())
+	}
+	return nil
+}
+
+// Migrate applies every pending migration without destructive steps.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	_, err := MigrateTo(ctx, db, LatestVersion(), MigrateOptions{})
+	return err
+}
+
+// MigrateTo applies pending migrations up to and including target. Each
+// runs in its own transaction. The report is returned even on error, since
+// earlier steps may have changed the database.
+func MigrateTo(ctx context.Context, db *sql.DB, target int, opts MigrateOptions) (*MigrationReport, error) {
+	report := &MigrationReport{}
+	if target < 0 || target > LatestVersion() {
+		return report, fmt.Errorf("%w: unknown schema version %d (latest is %d)", ErrBadTarget, target, LatestVersion())
+	}
+	if err := checkSchemaVersion(ctx, db); err != nil {
+		return report, err
+	}
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return report, err
+	}
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	// Legacy tables are dropped on request at any version, since adoption
+	// will have kept them the first time.
+	if (current == 0 && target > 0) || opts.AllowDestructive {
+		if err := adoptLegacySchema(ctx, db, current, opts, report); err != nil {
+			return report, err
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		if drops(m.up) {
+			if err := backupIfData(ctx, db, report); err != nil {
+				return report, err
+			}
+		}
+		var lost []string
+		prepare := func(conn *sql.Conn) (err error) {
+			if losses := migrationLosses[m.Version]; losses != nil {
+				lost, err = losses(ctx, conn)
+			}
+			return err
+		}
+		ok, err := runMigrationStep(ctx, db, m.Version-1, m.Version, m.up, prepare, func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `INSERT OR REPLACE INTO schema_migrations(version, name) VALUES (?, ?)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return report, fmt.Errorf("apply migration %s: %w", m, err)
+		}
+		if ok {
+			report.Applied = append(report.Applied, m)
+			report.Changes = append(report.Changes, lost...)
+		}
+	}
+	return report, nil
+}
+
+// Rollback reverts applied migrations above target, newest first. It stops
+// at a migration without a down file. The database is backed up before the
+// first step that drops a table or column. The report lists the reverted
+// migrations and is returned even on error.
+func Rollback(ctx context.Context, db *sql.DB, target int) (*MigrationReport, error) {
+	report := &MigrationReport{}
+	if err := checkSchemaVersion(ctx, db); err != nil {
+		return report, err
+	}
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return report, err
+	}
+	current, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	if target < 0 || target > current {
+		return report, fmt.Errorf("%w: cannot roll back to version %d from version %d", ErrBadTarget, target, current)
+	}
+
+	for v := current; v > target; v-- {
+		m := migrations[v-1]
+		if !m.Reversible() {
+			return report, fmt.Errorf("%w: migration %s cannot be rolled back", ErrBadTarget, m)
+		}
+		if drops(m.down) {
+			if err := autoBackup(ctx, db, report); err != nil {
+				return report, err
+			}
+		}
+		ok, err := runMigrationStep(ctx, db, m.Version, m.Version-1, m.down, nil, func(conn *sql.Conn) error {
+			_, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return report, fmt.Errorf("roll back migration %s: %w", m, err)
+		}
+		if ok {
+			report.Reverted = append(report.Reverted, m)
+		}
+	}
+	return report, nil
+}
+
+// runMigrationStep moves the schema from version from to version to by
+// running prepare, if set, then script, all in one write transaction. It
+// reports false without doing anything if another process moved the schema
+// first.
+func runMigrationStep(ctx context.Context, db *sql.DB, from, to int, script string, prepare, record func(*sql.Conn) error) (bool, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return false, err
+	}
+	done := false
+	defer func() {
+		if !done {
+			_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
+
+	var current int
+	if err := conn.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&current); err != nil {
+		return false, err
+	}
+	if current != from {
+		return false, nil
+	}
+	if prepare != nil {
+		if err := prepare(conn); err != nil {
+			return false, err
+		}
+	}
+	if _, err := conn.ExecContext(ctx, script); err != nil {
+		return false, err
+	}
+	if err := record(conn); err != nil {
+		return false, err
+	}
+	// PRAGMA arguments cannot be bound; to is always an int.
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", to)); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return false, err
+	}
+	done = true
+	return true, nil
+}
+
+func ensureMigrationsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// adoptLegacySchema brings a database created before versioned migrations
+// to the shape migration 1 expects. The later migrations only create what
+// is missing, so they are safe to run over the legacy tables. Once migrated,
+// the issues table no longer has that shape, so only legacy tables are
+// dropped.
+func adoptLegacySchema(ctx context.Context, db *sql.DB, current int, opts MigrateOptions, report *MigrationReport) error {
+	if current == 0 {
+		if err := ensureIssuesTableMinimalShape(ctx, db, opts, report); err != nil {
+			return err
+		}
+	}
+	return dropLegacyTables(ctx, db, opts, report)
+}
+
+// MigrationStatus is one migration and whether the database has it.
+type MigrationStatus struct {
+	Version    int        `json:"version"`
+	Name       string     `json:"name"`
+	Reversible bool       `json:"reversible"`
+	Applied    bool       `json:"applied"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+}
+
+// SchemaStatus describes where a database stands against this binary.
+type SchemaStatus struct {
+	Version    int               `json:"version"`
+	Latest     int               `json:"latest"`
+	Migrations []MigrationStatus `json:"migrations"`
+}
+
+func Status(ctx context.Context, db *sql.DB) (*SchemaStatus, error) {
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time)
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		var at string
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, fmt.Errorf("scan schema_migrations: %w", err)
+		}
+		t, err := time.ParseInLocation(time.DateTime, at, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("parse applied_at %q: %w", at, err)
+		}
+		appliedAt[v] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	st := &SchemaStatus{Version: version, Latest: LatestVersion(), Migrations: make([]MigrationStatus, 0, len(migrations))}
+	for _, m := range migrations {
+		ms := MigrationStatus{Version: m.Version, Name: m.Name, Reversible: m.Reversible(), Applied: m.Version <= version}
+		if t, ok := appliedAt[m.Version]; ok {
+			ms.AppliedAt = &t
+		}
+		st.Migrations = append(st.Migrations, ms)
+	}
+	return st, nil
+}
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openRaw(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "issues.db")
+	database, err := Connect(context.Background(), path)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	return database, path
+}
+
+func hasTable(t *testing.T, database *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	if err := database.QueryRow(`SELECT COUNT(1) FROM sqlite_master WHERE name = ?`, name).Scan(&n); err != nil {
+		t.Fatalf("inspect %s: %v", name, err)
+	}
+	return n > 0
+}
+
+func TestLoadMigrations(t *testing.T) {
+	ms := Migrations()
+	if len(ms) == 0 || LatestVersion() != len(ms) {
+		t.Fatalf("unexpected migrations: %d, latest %d", len(ms), LatestVersion())
+	}
+	if ms[0].Reversible() {
+		t.Fatal("baseline migration should not be reversible")
+	}
+	for i, m := range ms {
+		if m.Version != i+1 {
+			t.Fatalf("migration %d has version %d", i+1, m.Version)
+		}
+	}
+}
+
+func TestMigrateStatusAndRollback(t *testing.T) {
+	ctx := context.Background()
+	database, path := openRaw(t)
+
+	report, err := MigrateTo(ctx, database, 2, MigrateOptions{})
+	if err != nil {
+		t.Fatalf("migrate to 2: %v", err)
+	}
+	if len(report.Applied) != 2 || report.Backup != "" || len(report.Changes) != 0 {
+		t.Fatalf("unexpected report for a new database: %+v", report)
+	}
+	st, err := Status(ctx, database)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if st.Version != 2 || st.Latest != LatestVersion() || !st.Migrations[1].Applied || st.Migrations[2].Applied || st.Migrations[1].AppliedAt == nil {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	if err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if v, _ := SchemaVersion(ctx, database); v != LatestVersion() {
+		t.Fatalf("expected version %d, got %d", LatestVersion(), v)
+	}
+	if !hasTable(t, database, "saved_views") {
+		t.Fatal("expected saved_views after migrating")
+	}
+
+	rolledBack, err := Rollback(ctx, database, 1)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if reverted := rolledBack.Reverted; len(reverted) != LatestVersion()-1 || reverted[0].Version != LatestVersion() {
+		t.Fatalf("unexpected rollback: %+v", reverted)
+	}
+	if !strings.HasPrefix(rolledBack.Backup, path+".backup-") || !fileExists(rolledBack.Backup) {
+		t.Fatalf("expected a backup before dropping tables, got %q", rolledBack.Backup)
+	}
+	if hasTable(t, database, "saved_views") || hasTable(t, database, "issue_events") || !hasTable(t, database, "issues") {
+		t.Fatal("rollback should drop later tables and keep issues")
+	}
+	var recorded int
+	if err := database.QueryRow(`SELECT COUNT(1) FROM schema_migrations`).Scan(&recorded); err != nil || recorded != 1 {
+		t.Fatalf("expected 1 recorded migration, got %d (%v)", recorded, err)
+	}
+	if _, err := Rollback(ctx, database, 0); !errors.Is(err, ErrBadTarget) {
+		t.Fatalf("expected baseline rollback to fail, got %v", err)
+	}
+	if _, err := MigrateTo(ctx, database, LatestVersion()+1, MigrateOptions{}); !errors.Is(err, ErrBadTarget) {
+		t.Fatalf("expected unknown target to fail, got %v", err)
+	}
+}
+
+func TestMigrateBlockedByIntoDependencies(t *testing.T) {
+	ctx := context.Background()
+	database, path := openRaw(t)
+	if _, err := MigrateTo(ctx, database, 7, MigrateOptions{}); err != nil {
+		t.Fatalf("migrate to 7: %v", err)
+	}
+	if _, err := database.Exec(`
+		INSERT INTO issues(id, category, title, state, blocked_by) VALUES
+			('cat-1', 'project', 'A', 'todo', '[]'),
+			('cat-2', 'project', 'B', 'todo', '["cat-3","CAT-1","cat-99","cat-2"]'),
+			('cat-3', 'project', 'C', 'todo', 'not json')
+	`); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	report, err := MigrateTo(ctx, database, 8, MigrateOptions{})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if !strings.HasPrefix(report.Backup, path+".backup-") || !fileExists(report.Backup) {
+		t.Fatalf("expected a backup before dropping blocked_by, got %q", report.Backup)
+	}
+	wantChanges := []string{
+		`dropped blocked_by entry "cat-99" of cat-2: not the ID of another issue`,
+		`dropped blocked_by entry "cat-2" of cat-2: not the ID of another issue`,
+		`dropped blocked_by of cat-3: "not json" is not a JSON list`,
+	}
+	if strings.Join(report.Changes, "\n") != strings.Join(wantChanges, "\n") {
+		t.Fatalf("unexpected changes: %q", report.Changes)
+	}
+	deps := func() string {
+		rows, err := database.Query(`SELECT issue_id || '>' || depends_on_id FROM issue_dependencies ORDER BY issue_id, position`)
+		if err != nil {
+			t.Fatalf("read dependencies: %v", err)
+		}
+		defer rows.Close()
+		var out []string
+		for rows.Next() {
+			var dep string
+			if err := rows.Scan(&dep); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, dep)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := deps(); got != "cat-2>cat-3,cat-2>cat-1" {
+		t.Fatalf("unexpected dependencies: %s", got)
+	}
+
+	if _, err := Rollback(ctx, database, 7); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	var blockedBy string
+	if err := database.QueryRow(`SELECT blocked_by FROM issues WHERE id = 'cat-2'`).Scan(&blockedBy); err != nil || blockedBy != `["cat-3","cat-1"]` {
+		t.Fatalf("expected blocked_by restored, got %q, %v", blockedBy, err)
+	}
+	if err := database.QueryRow(`SELECT blocked_by FROM issues WHERE id = 'cat-3'`).Scan(&blockedBy); err != nil || blockedBy != "[]" {
+		t.Fatalf("expected empty blocked_by, got %q, %v", blockedBy, err)
+	}
+}
+
+func TestSearchIndexKeyedByRowid(t *testing.T) {
+	ctx := context.Background()
+	database, _ := openRaw(t)
+	if _, err := MigrateTo(ctx, database, 8, MigrateOptions{}); err != nil {
+		t.Fatalf("migrate to 8: %v", err)
+	}
+	if _, err := database.Exec(`
+		INSERT INTO issues(id, category, title, state) VALUES
+			('cat-1', 'project', 'Alpha', 'todo'),
+			('cat-2', 'project', 'Beta', 'todo');
+		INSERT INTO comments(issue_id, body) VALUES ('cat-2', 'gamma');
+		DELETE FROM issues WHERE id = 'cat-1';
+	`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := database.Exec(`
+		INSERT INTO issues(id, category, title, state) VALUES ('cat-3', 'project', 'Delta', 'todo');
+		UPDATE issues SET title = 'Epsilon' WHERE id = 'cat-2';
+		INSERT INTO comments(issue_id, body) VALUES ('cat-3', 'zeta');
+	`); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	var mismatched int
+	if err := database.QueryRow(`
+		SELECT COUNT(1) FROM issues i
+		FULL JOIN issues_fts f ON f.rowid = i.rowid
+		WHERE i.id IS NULL OR f.issue_id IS NULL OR f.issue_id != i.id
+	`).Scan(&mismatched); err != nil || mismatched != 0 {
+		t.Fatalf("expected index rows keyed by issue rowid, %d mismatched (%v)", mismatched, err)
+	}
+	search := func(q string) string {
+		var id string
+		if err := database.QueryRow(`SELECT issue_id FROM issues_fts WHERE issues_fts MATCH ?`, q).Scan(&id); err != nil && err != sql.ErrNoRows {
+			t.Fatalf("search %q: %v", q, err)
+		}
+		return id
+	}
+	for q, want := range map[string]string{"epsilon": "cat-2", "gamma": "cat-2", "zeta": "cat-3", "beta": "", "alpha": ""} {
+		if got := search(q); got != want {
+			t.Fatalf("search %q: expected %q, got %q", q, want, got)
+		}
+	}
+
+	if _, err := Rollback(ctx, database, 8); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if _, err := database.Exec(`DELETE FROM comments WHERE issue_id = 'cat-3'`); err != nil {
+		t.Fatalf("delete comment: %v", err)
+	}
+	if got := search("zeta"); got != "" {
+		t.Fatalf("expected the 0006 triggers back after rollback, got %q", got)
+	}
+}
+
+func TestRefuseNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	database, path := openRaw(t)
+	if err := Migrate(ctx, database); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := database.Exec(`PRAGMA user_version = 999`); err != nil {
+		t.Fatalf("set user_version: %v", err)
+	}
+	if _, err := Open(ctx, path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+// createLegacyDB writes a pre-migration database with an issues table
+// missing most baseline columns, extra columns, and an unused projects table.
+func createLegacyDB(t *testing.T, extraColumns string) string {
+	t.Helper()
+	database, path := openRaw(t)
+	_, err := database.Exec(`
+		CREATE TABLE issues (
+			id TEXT PRIMARY KEY,
+			category TEXT NOT NULL,
+			title TEXT NOT NULL,
+			state TEXT NOT NULL,
+			parent_id TEXT,` + extraColumns + `
+			created_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP),
+			updated_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP)
+		);
+		CREATE TABLE projects (prefix TEXT PRIMARY KEY);
+		INSERT INTO projects(prefix) VALUES ('cat');
+		INSERT INTO issues(id, category, title, state, updated_at) VALUES ('cat-1', 'project', 'Legacy root', 'todo', '2024-01-02 03:04:05');
+	`)
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+	_ = database.Close()
+	return path
+}
+
+func TestAdoptLegacyDatabase(t *testing.T) {
+	ctx := context.Background()
+	path := createLegacyDB(t, "")
+	database, err := Connect(ctx, path)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer database.Close()
+
+	report, err := MigrateTo(ctx, database, LatestVersion(), MigrateOptions{})
+	if err != nil {
+		t.Fatalf("migrate legacy db: %v", err)
+	}
+	if v, _ := SchemaVersion(ctx, database); v != LatestVersion() {
+		t.Fatalf("expected version %d, got %d", LatestVersion(), v)
+	}
+	if report.Backup == "" || len(report.Changes) != 2 {
+		t.Fatalf("expected a backup and two changes, got %+v", report)
+	}
+	if _, err := os.Stat(report.Backup); err != nil {
+		t.Fatalf("backup missing: %v", err)
+	}
+	if !hasTable(t, database, "projects") {
+		t.Fatal("legacy projects table should be kept without AllowDestructive")
+	}
+	var lastUpdated, indexed string
+	if err := database.QueryRow(`SELECT last_updated_at FROM issues WHERE id = 'cat-1'`).Scan(&lastUpdated); err != nil {
+		t.Fatalf("read migrated issue: %v", err)
+	}
+	if lastUpdated != "2024-01-02 03:04:05" {
+		t.Fatalf("expected updated_at to carry over, got %q", lastUpdated)
+	}
+	if err := database.QueryRow(`SELECT title FROM issues_fts WHERE issue_id = 'cat-1'`).Scan(&indexed); err != nil || indexed != "Legacy root" {
+		t.Fatalf("expected legacy issue in search index, got %q (%v)", indexed, err)
+	}
+
+	report, err = MigrateTo(ctx, database, LatestVersion(), MigrateOptions{AllowDestructive: true})
+	if err != nil {
+		t.Fatalf("migrate with AllowDestructive: %v", err)
+	}
+	if hasTable(t, database, "projects") || report.Backup == "" {
+		t.Fatalf("expected projects dropped after a backup, got %+v", report)
+	}
+}
+
+func TestAdoptLegacyDatabaseRefusesToDropColumns(t *testing.T) {
+	ctx := context.Background()
+	path := createLegacyDB(t, "\n\t\t\tpriority INTEGER,")
+
+	if _, err := Open(ctx, path); !errors.Is(err, ErrDestructiveMigration) {
+		t.Fatalf("expected ErrDestructiveMigration, got %v", err)
+	}
+	database, err := Connect(ctx, path)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer database.Close()
+	if v, _ := SchemaVersion(ctx, database); v != 0 {
+		t.Fatalf("refused migration should leave version 0, got %d", v)
+	}
+
+	report, err := MigrateTo(ctx, database, LatestVersion(), MigrateOptions{AllowDestructive: true})
+	if err != nil {
+		t.Fatalf("migrate with AllowDestructive: %v", err)
+	}
+	if report.Backup == "" {
+		t.Fatal("expected a backup before the rebuild")
+	}
+	columns, err := issueColumns(ctx, database)
+	if err != nil {
+		t.Fatalf("issue columns: %v", err)
+	}
+	if _, ok := columns["priority"]; ok {
+		t.Fatal("expected priority column to be dropped")
+	}
+}
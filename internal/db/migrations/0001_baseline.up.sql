@@ -1,5 +1,3 @@
-PRAGMA foreign_keys = ON;
-
 CREATE TABLE IF NOT EXISTS issues (
   id TEXT PRIMARY KEY,
   category TEXT NOT NULL,
@@ -9,9 +7,12 @@ CREATE TABLE IF NOT EXISTS issues (
   parent_id TEXT,
   version INTEGER NOT NULL DEFAULT 1,
   blocked_by TEXT NOT NULL DEFAULT '[]',
+  blocked_reason TEXT,
   created_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP),
   last_updated_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP),
   closed_at TEXT,
+  archived_at TEXT,
+  assignee TEXT,
   FOREIGN KEY (parent_id) REFERENCES issues(id) ON DELETE SET NULL
 );
 
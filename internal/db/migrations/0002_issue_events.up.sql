@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS issue_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  issue_id TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  old_value TEXT,
+  new_value TEXT,
+  version INTEGER NOT NULL,
+  actor TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP)
+);
+
+CREATE INDEX IF NOT EXISTS idx_issue_events_issue ON issue_events(issue_id, id);
+
+CREATE TRIGGER IF NOT EXISTS trg_issue_events_no_update
+BEFORE UPDATE ON issue_events
+BEGIN
+  SELECT RAISE(ABORT, 'issue_events is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_issue_events_no_delete
+BEFORE DELETE ON issue_events
+BEGIN
+  SELECT RAISE(ABORT, 'issue_events is append-only');
+END;
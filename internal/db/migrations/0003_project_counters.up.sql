@@ -0,0 +1,5 @@
+-- Counters are seeded lazily from the highest existing issue number.
+CREATE TABLE IF NOT EXISTS project_counters (
+  project_prefix TEXT PRIMARY KEY,
+  last_number INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS issue_labels (
+  issue_id TEXT NOT NULL,
+  label TEXT NOT NULL,
+  PRIMARY KEY (issue_id, label),
+  FOREIGN KEY (issue_id) REFERENCES issues(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_issue_labels_label ON issue_labels(label);
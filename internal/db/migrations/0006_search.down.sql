@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS trg_comments_fts_delete;
+DROP TRIGGER IF EXISTS trg_comments_fts_insert;
+DROP TRIGGER IF EXISTS trg_issues_fts_delete;
+DROP TRIGGER IF EXISTS trg_issues_fts_update;
+DROP TRIGGER IF EXISTS trg_issues_fts_insert;
+DROP TABLE IF EXISTS issues_fts;
@@ -0,0 +1,49 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS issues_fts USING fts5(
+  issue_id UNINDEXED,
+  title,
+  body,
+  comments,
+  tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_issues_fts_insert
+AFTER INSERT ON issues
+BEGIN
+  INSERT INTO issues_fts(issue_id, title, body, comments) VALUES (NEW.id, NEW.title, NEW.body, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_issues_fts_update
+AFTER UPDATE OF title, body ON issues
+BEGIN
+  UPDATE issues_fts SET title = NEW.title, body = NEW.body WHERE issue_id = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_issues_fts_delete
+AFTER DELETE ON issues
+BEGIN
+  DELETE FROM issues_fts WHERE issue_id = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_comments_fts_insert
+AFTER INSERT ON comments
+BEGIN
+  UPDATE issues_fts
+  SET comments = (SELECT group_concat(body, char(10)) FROM comments WHERE issue_id = NEW.issue_id)
+  WHERE issue_id = NEW.issue_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS trg_comments_fts_delete
+AFTER DELETE ON comments
+BEGIN
+  UPDATE issues_fts
+  SET comments = COALESCE((SELECT group_concat(body, char(10)) FROM comments WHERE issue_id = OLD.issue_id), '')
+  WHERE issue_id = OLD.issue_id;
+END;
+
+-- Index issues that predate the search table.
+DELETE FROM issues_fts WHERE issue_id NOT IN (SELECT id FROM issues);
+
+INSERT INTO issues_fts(issue_id, title, body, comments)
+SELECT i.id, i.title, i.body, COALESCE((SELECT group_concat(c.body, char(10)) FROM comments c WHERE c.issue_id = i.id), '')
+FROM issues i
+WHERE i.id NOT IN (SELECT issue_id FROM issues_fts);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS saved_views (
+  name TEXT PRIMARY KEY,
+  project_prefix TEXT NOT NULL DEFAULT '',
+  query TEXT NOT NULL DEFAULT '',
+  sort TEXT NOT NULL DEFAULT '',
+  reverse INTEGER NOT NULL DEFAULT 0,
+  include_archived INTEGER NOT NULL DEFAULT 0,
+  created_by TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP),
+  updated_at TEXT NOT NULL DEFAULT (CURRENT_TIMESTAMP)
+);
@@ -0,0 +1,10 @@
+ALTER TABLE issues ADD COLUMN blocked_by TEXT NOT NULL DEFAULT '[]';
+
+UPDATE issues
+SET blocked_by = (
+  SELECT json_group_array(depends_on_id)
+  FROM (SELECT depends_on_id FROM issue_dependencies WHERE issue_id = issues.id ORDER BY position)
+)
+WHERE id IN (SELECT issue_id FROM issue_dependencies);
+
+DROP TABLE IF EXISTS issue_dependencies;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS issue_dependencies (
+  issue_id TEXT NOT NULL,
+  depends_on_id TEXT NOT NULL,
+  position INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (issue_id, depends_on_id),
+  CHECK (issue_id != depends_on_id),
+  FOREIGN KEY (issue_id) REFERENCES issues(id) ON DELETE CASCADE,
+  FOREIGN KEY (depends_on_id) REFERENCES issues(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_issue_dependencies_depends_on ON issue_dependencies(depends_on_id);
+
+-- Copy the blocked_by JSON lists, keeping their order. Entries that are not
+-- IDs of other existing issues cannot satisfy the foreign keys and are
+-- dropped; MigrateTo backs the database up and reports them first.
+INSERT OR IGNORE INTO issue_dependencies(issue_id, depends_on_id, position)
+SELECT i.id, dep.id, d.key
+FROM issues i
+JOIN json_each(CASE WHEN json_valid(i.blocked_by) AND json_type(i.blocked_by) = 'array' THEN i.blocked_by ELSE '[]' END) d
+JOIN issues dep ON dep.id = lower(trim(d.value))
+WHERE d.type = 'text' AND dep.id != i.id;
+
+ALTER TABLE issues DROP COLUMN blocked_by;
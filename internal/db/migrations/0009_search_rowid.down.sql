@@ -0,0 +1,39 @@
+DROP TRIGGER IF EXISTS trg_issues_fts_insert;
+DROP TRIGGER IF EXISTS trg_issues_fts_update;
+DROP TRIGGER IF EXISTS trg_issues_fts_delete;
+DROP TRIGGER IF EXISTS trg_comments_fts_insert;
+DROP TRIGGER IF EXISTS trg_comments_fts_delete;
+
+CREATE TRIGGER trg_issues_fts_insert
+AFTER INSERT ON issues
+BEGIN
+  INSERT INTO issues_fts(issue_id, title, body, comments) VALUES (NEW.id, NEW.title, NEW.body, '');
+END;
+
+CREATE TRIGGER trg_issues_fts_update
+AFTER UPDATE OF title, body ON issues
+BEGIN
+  UPDATE issues_fts SET title = NEW.title, body = NEW.body WHERE issue_id = NEW.id;
+END;
+
+CREATE TRIGGER trg_issues_fts_delete
+AFTER DELETE ON issues
+BEGIN
+  DELETE FROM issues_fts WHERE issue_id = OLD.id;
+END;
+
+CREATE TRIGGER trg_comments_fts_insert
+AFTER INSERT ON comments
+BEGIN
+  UPDATE issues_fts
+  SET comments = (SELECT group_concat(body, char(10)) FROM comments WHERE issue_id = NEW.issue_id)
+  WHERE issue_id = NEW.issue_id;
+END;
+
+CREATE TRIGGER trg_comments_fts_delete
+AFTER DELETE ON comments
+BEGIN
+  UPDATE issues_fts
+  SET comments = COALESCE((SELECT group_concat(body, char(10)) FROM comments WHERE issue_id = OLD.issue_id), '')
+  WHERE issue_id = OLD.issue_id;
+END;
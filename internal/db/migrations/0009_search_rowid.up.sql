@@ -0,0 +1,48 @@
+-- Key search rows by the issue's rowid. issue_id is UNINDEXED, so the 0006
+-- triggers that matched on it scanned the whole index on every edit.
+DROP TRIGGER IF EXISTS trg_issues_fts_insert;
+DROP TRIGGER IF EXISTS trg_issues_fts_update;
+DROP TRIGGER IF EXISTS trg_issues_fts_delete;
+DROP TRIGGER IF EXISTS trg_comments_fts_insert;
+DROP TRIGGER IF EXISTS trg_comments_fts_delete;
+
+CREATE TRIGGER trg_issues_fts_insert
+AFTER INSERT ON issues
+BEGIN
+  INSERT INTO issues_fts(rowid, issue_id, title, body, comments) VALUES (NEW.rowid, NEW.id, NEW.title, NEW.body, '');
+END;
+
+CREATE TRIGGER trg_issues_fts_update
+AFTER UPDATE OF title, body ON issues
+BEGIN
+  UPDATE issues_fts SET title = NEW.title, body = NEW.body WHERE rowid = NEW.rowid;
+END;
+
+CREATE TRIGGER trg_issues_fts_delete
+AFTER DELETE ON issues
+BEGIN
+  DELETE FROM issues_fts WHERE rowid = OLD.rowid;
+END;
+
+CREATE TRIGGER trg_comments_fts_insert
+AFTER INSERT ON comments
+BEGIN
+  UPDATE issues_fts
+  SET comments = (SELECT group_concat(body, char(10)) FROM comments WHERE issue_id = NEW.issue_id)
+  WHERE rowid = (SELECT rowid FROM issues WHERE id = NEW.issue_id);
+END;
+
+CREATE TRIGGER trg_comments_fts_delete
+AFTER DELETE ON comments
+BEGIN
+  UPDATE issues_fts
+  SET comments = COALESCE((SELECT group_concat(body, char(10)) FROM comments WHERE issue_id = OLD.issue_id), '')
+  WHERE rowid = (SELECT rowid FROM issues WHERE id = OLD.issue_id);
+END;
+
+-- Rebuild the index under the new keys.
+DELETE FROM issues_fts;
+
+INSERT INTO issues_fts(rowid, issue_id, title, body, comments)
+SELECT i.rowid, i.id, i.title, i.body, COALESCE((SELECT group_concat(c.body, char(10)) FROM comments c WHERE c.issue_id = i.id), '')
+FROM issues i;
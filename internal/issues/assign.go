@@ -0,0 +1,130 @@
+package issues
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AssignIssue sets the owner of an issue. An empty assignee unassigns it.
+func (s *Service) AssignIssue(ctx context.Context, id, assignee string, expectedVersion *int64) (*Issue, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	assignee = strings.TrimSpace(assignee)
+	var newAssignee any
+	if assignee != "" {
+		newAssignee = assignee
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issue, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "UPDATE issues SET assignee = ?, version = version + 1, last_updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	args := []any{newAssignee, id}
+	if expectedVersion != nil {
+		query += " AND version = ?"
+		args = append(args, *expectedVersion)
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		if expectedVersion != nil {
+			return nil, staleWriteError(id, *expectedVersion, issue.Version)
+		}
+		return nil, notFoundError(id)
+	}
+
+	updated, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordEventTx(ctx, tx, id, EventAssignee, issue.Assignee, updated.Assignee, updated.Version, s.actor); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// ClaimIssue atomically assigns an unassigned todo issue and moves it to
+// in_progress. It fails with ErrConflict if someone else already owns it.
+func (s *Service) ClaimIssue(ctx context.Context, id, assignee string) (*Issue, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	assignee = strings.TrimSpace(assignee)
+	if assignee == "" {
+		return nil, invalidField("assignee", "assignee is required to claim an issue")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issue, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if issue.Assignee != nil {
+		return nil, &Error{Kind: ErrConflict, Message: fmt.Sprintf("issue %q is already assigned to %s", id, *issue.Assignee), Field: "assignee", IDs: []string{id}}
+	}
+	if issue.State != StateTodo {
+		return nil, &Error{Kind: ErrInvalidStateTransition, Message: fmt.Sprintf("can only claim %s issues, %q is %s", StateTodo, id, issue.State), Field: "state", IDs: []string{id}}
+	}
+	unresolved, err := unresolvedBlockedByTx(ctx, tx, issue)
+	if err != nil {
+		return nil, err
+	}
+	if len(unresolved) > 0 {
+		return nil, &Error{Kind: ErrInvalidInput, Message: "blocked_by not done: " + strings.Join(unresolved, ","), Field: "blocked_by", IDs: unresolved}
+	}
+
+	// The guard on state and assignee keeps the claim atomic if another
+	// writer got in between the read above and this update.
+	res, err := tx.ExecContext(ctx, `
+		UPDATE issues
+		SET assignee = ?, state = ?, closed_at = NULL, blocked_reason = NULL, version = version + 1, last_updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND state = ? AND assignee IS NULL
+	`, assignee, string(StateInProgress), id, string(StateTodo))
+	if err != nil {
+		return nil, err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return nil, &Error{Kind: ErrConflict, Message: fmt.Sprintf("issue %q was claimed concurrently", id), Field: "assignee", IDs: []string{id}}
+	}
+
+	updated, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordEventTx(ctx, tx, id, EventAssignee, nil, updated.Assignee, updated.Version, s.actor); err != nil {
+		return nil, err
+	}
+	if err := recordEventTx(ctx, tx, id, EventState, stringPtr(string(issue.State)), stringPtr(string(updated.State)), updated.Version, s.actor); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
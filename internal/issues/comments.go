@@ -0,0 +1,93 @@
+package issues
+
+import (
+	"context"
+	"strings"
+)
+
+// AddComment appends a comment to an issue, authored by the service actor.
+func (s *Service) AddComment(ctx context.Context, issueID, text string) (*Comment, error) {
+	issueID = strings.TrimSpace(issueID)
+	if issueID == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, invalidField("text", "comment text is required")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getIssueByIDTx(ctx, tx, issueID); err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO comments(issue_id, author, body) VALUES (?, ?, ?)`, issueID, s.actor, text)
+	if err != nil {
+		return nil, err
+	}
+	commentID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	var c Comment
+	var created string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, issue_id, author, body, created_at
+		FROM comments
+		WHERE id = ?
+	`, commentID).Scan(&c.ID, &c.IssueID, &c.Author, &c.Body, &created)
+	if err != nil {
+		return nil, err
+	}
+	if c.CreatedAt, err = parseSQLiteTime(created); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListComments returns the comments on an issue, oldest first.
+func (s *Service) ListComments(ctx context.Context, issueID string) ([]Comment, error) {
+	issueID = strings.TrimSpace(issueID)
+	if issueID == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	if _, err := getIssueByIDDB(ctx, s.db, issueID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, issue_id, author, body, created_at
+		FROM comments
+		WHERE issue_id = ?
+		ORDER BY id ASC
+	`, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Comment, 0)
+	for rows.Next() {
+		var c Comment
+		var created string
+		if err := rows.Scan(&c.ID, &c.IssueID, &c.Author, &c.Body, &created); err != nil {
+			return nil, err
+		}
+		if c.CreatedAt, err = parseSQLiteTime(created); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,257 @@
+package issues
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DeleteIssue permanently removes an issue. Issues with children are refused
+// unless cascade is set, in which case every descendant is deleted too. The
+// removed IDs are scrubbed from the blocked_by lists of the remaining issues.
+// It returns the IDs that were deleted.
+func (s *Service) DeleteIssue(ctx context.Context, id string, cascade bool, expectedVersion *int64) ([]string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issue, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != nil && issue.Version != *expectedVersion {
+		return nil, staleWriteError(id, *expectedVersion, issue.Version)
+	}
+
+	descendants, err := descendantsTx(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(descendants) > 0 && !cascade {
+		return nil, &Error{Kind: ErrInvalidInput, Message: fmt.Sprintf("issue %q has %d descendant(s); use cascade to delete them too", id, len(descendants)), Field: "cascade", IDs: issueIDs(descendants)}
+	}
+
+	doomed := append([]*Issue{issue}, descendants...)
+	ids := issueIDs(doomed)
+
+	if err := s.scrubBlockedByTx(ctx, tx, doomed); err != nil {
+		return nil, err
+	}
+
+	// Delete leaves first so ON DELETE SET NULL never fires on a doomed child.
+	for i := len(doomed) - 1; i >= 0; i-- {
+		is := doomed[i]
+		for _, stmt := range []string{
+			`DELETE FROM issue_dependencies WHERE issue_id = ?`,
+			`DELETE FROM issue_labels WHERE issue_id = ?`,
+			`DELETE FROM comments WHERE issue_id = ?`,
+			`DELETE FROM issues WHERE id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, is.ID); err != nil {
+				return nil, err
+			}
+		}
+		if err := recordEventTx(ctx, tx, is.ID, EventDelete, stringPtr(string(is.State)), nil, is.Version, s.actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ArchiveIssue hides an issue from list and tree output without deleting it.
+// Issues with unarchived children are refused unless cascade is set, in which
+// case every unarchived descendant is archived too. As with DeleteIssue, the
+// archived IDs are scrubbed from the blocked_by lists of the other issues, so
+// nothing stays blocked on work nobody will finish.
+func (s *Service) ArchiveIssue(ctx context.Context, id string, cascade bool, expectedVersion *int64) (*Issue, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issue, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if issue.ArchivedAt != nil {
+		return nil, &Error{Kind: ErrInvalidInput, Message: fmt.Sprintf("issue %q is already archived", id), IDs: []string{id}}
+	}
+
+	descendants, err := descendantsTx(ctx, tx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(descendants) > 0 && !cascade {
+		return nil, &Error{Kind: ErrInvalidInput, Message: fmt.Sprintf("issue %q has %d unarchived descendant(s); use cascade to archive them too", id, len(descendants)), Field: "cascade", IDs: issueIDs(descendants)}
+	}
+	if err := s.scrubBlockedByTx(ctx, tx, append([]*Issue{issue}, descendants...)); err != nil {
+		return nil, err
+	}
+
+	query := "UPDATE issues SET archived_at = CURRENT_TIMESTAMP, version = version + 1, last_updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	args := []any{id}
+	if expectedVersion != nil {
+		query += " AND version = ?"
+		args = append(args, *expectedVersion)
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		if expectedVersion != nil {
+			return nil, staleWriteError(id, *expectedVersion, issue.Version)
+		}
+		return nil, notFoundError(id)
+	}
+	if err := recordEventTx(ctx, tx, id, EventArchive, nil, stringPtr("archived"), issue.Version+1, s.actor); err != nil {
+		return nil, err
+	}
+
+	for _, child := range descendants {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE issues SET archived_at = CURRENT_TIMESTAMP, version = version + 1, last_updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, child.ID); err != nil {
+			return nil, err
+		}
+		if err := recordEventTx(ctx, tx, child.ID, EventArchive, nil, stringPtr("archived"), child.Version+1, s.actor); err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// descendantsTx returns every issue below id in the hierarchy, parents before
+// their children.
+func descendantsTx(ctx context.Context, tx *sql.Tx, id string, includeArchived bool) ([]*Issue, error) {
+	rows, err := tx.QueryContext(ctx, `
+		WITH RECURSIVE sub(id, depth) AS (
+			SELECT id, 1 FROM issues WHERE parent_id = ?
+			UNION ALL
+			SELECT i.id, sub.depth + 1 FROM issues i JOIN sub ON i.parent_id = sub.id
+		)
+		SELECT id FROM sub ORDER BY depth ASC, id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var childID string
+		if err := rows.Scan(&childID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, childID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]*Issue, 0, len(ids))
+	for _, childID := range ids {
+		child, err := getIssueByIDTx(ctx, tx, childID)
+		if err != nil {
+			return nil, err
+		}
+		if !includeArchived && child.ArchivedAt != nil {
+			continue
+		}
+		out = append(out, child)
+	}
+	return out, nil
+}
+
+// scrubBlockedByTx removes the removed issues from the blocked_by lists of
+// the issues they block, recording a blocked_by event for each change.
+func (s *Service) scrubBlockedByTx(ctx context.Context, tx *sql.Tx, removed []*Issue) error {
+	gone := make(map[string]bool, len(removed))
+	for _, is := range removed {
+		gone[is.ID] = true
+	}
+	var dependents []string
+	seen := make(map[string]bool)
+	for _, is := range removed {
+		for _, id := range is.Blocks {
+			if !gone[id] && !seen[id] {
+				seen[id] = true
+				dependents = append(dependents, id)
+			}
+		}
+	}
+	sort.Strings(dependents)
+
+	for _, id := range dependents {
+		is, err := getIssueByIDTx(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		kept := make([]string, 0, len(is.BlockedBy))
+		for _, dep := range is.BlockedBy {
+			if !gone[dep] {
+				kept = append(kept, dep)
+			}
+		}
+
+		oldValue, err := blockedByEventValue(is.BlockedBy)
+		if err != nil {
+			return err
+		}
+		keptJSON, err := json.Marshal(kept)
+		if err != nil {
+			return fmt.Errorf("marshal blocked_by: %w", err)
+		}
+		if err := setDependenciesTx(ctx, tx, is.ID, kept); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE issues SET version = version + 1, last_updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, is.ID); err != nil {
+			return err
+		}
+		if err := recordEventTx(ctx, tx, is.ID, EventBlockedBy, oldValue, stringPtr(string(keptJSON)), is.Version+1, s.actor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func issueIDs(list []*Issue) []string {
+	out := make([]string, 0, len(list))
+	for _, is := range list {
+		out = append(out, is.ID)
+	}
+	return out
+}
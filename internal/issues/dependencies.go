@@ -0,0 +1,123 @@
+package issues
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// checkBlockedByCycleTx walks the transitive blocked_by graph starting from
+// each proposed dependency and fails if any path leads back to issueID.
+func checkBlockedByCycleTx(ctx context.Context, tx *sql.Tx, issueID string, blockedBy []string) error {
+	visited := make(map[string]bool)
+	var walk func(id string, path []string) ([]string, error)
+	walk = func(id string, path []string) ([]string, error) {
+		path = append(path, id)
+		if id == issueID {
+			return path, nil
+		}
+		if visited[id] {
+			return nil, nil
+		}
+		visited[id] = true
+
+		deps, err := dependenciesTx(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, next := range deps {
+			cycle, err := walk(next, path)
+			if err != nil || cycle != nil {
+				return cycle, err
+			}
+		}
+		return nil, nil
+	}
+
+	for _, depID := range blockedBy {
+		cycle, err := walk(depID, []string{issueID})
+		if err != nil {
+			return err
+		}
+		if cycle != nil {
+			return &Error{Kind: ErrCycleDetected, Message: "blocked_by would create cycle: " + strings.Join(cycle, " -> "), Field: "blocked_by", IDs: cycle}
+		}
+	}
+	return nil
+}
+
+// UnresolvedDependencies returns, for each of the given issues that has
+// any, the blocked_by entries that are neither done nor archived.
+func (s *Service) UnresolvedDependencies(ctx context.Context, ids []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	// Stay well below SQLite's bound-parameter limit.
+	const batch = 500
+	for start := 0; start < len(ids); start += batch {
+		if err := s.addUnresolvedDependencies(ctx, ids[start:min(start+batch, len(ids))], out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// addUnresolvedDependencies adds the unresolved blocked_by entries of ids
+// to out.
+func (s *Service) addUnresolvedDependencies(ctx context.Context, ids []string, out map[string][]string) error {
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.issue_id, d.depends_on_id
+		FROM issue_dependencies d
+		JOIN issues dep ON dep.id = d.depends_on_id
+		WHERE d.issue_id IN (`+placeholders(len(ids))+`)
+			AND `+unresolvedDepCond+`
+		ORDER BY d.issue_id, d.position
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, dep string
+		if err := rows.Scan(&id, &dep); err != nil {
+			return err
+		}
+		out[id] = append(out[id], dep)
+	}
+	return rows.Err()
+}
+
+// dependenciesTx returns the blocked_by entries of id, in the order they
+// were set.
+func dependenciesTx(ctx context.Context, tx *sql.Tx, id string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT depends_on_id FROM issue_dependencies WHERE issue_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]string, 0)
+	for rows.Next() {
+		var dep string
+		if err := rows.Scan(&dep); err != nil {
+			return nil, err
+		}
+		out = append(out, dep)
+	}
+	return out, rows.Err()
+}
+
+// setDependenciesTx replaces the blocked_by entries of id with deps, which
+// must already be normalized.
+func setDependenciesTx(ctx context.Context, tx *sql.Tx, id string, deps []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM issue_dependencies WHERE issue_id = ?`, id); err != nil {
+		return err
+	}
+	for i, dep := range deps {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO issue_dependencies(issue_id, depends_on_id, position) VALUES (?, ?, ?)`, id, dep, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package issues
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Doctor check names, reported in Problem.Check.
+const (
+	CheckIntegrity     = "integrity"
+	CheckIssueID       = "invalid_id"
+	CheckCategory      = "invalid_category"
+	CheckState         = "invalid_state"
+	CheckParent        = "invalid_parent"
+	CheckOrphan        = "orphaned"
+	CheckBlockedBy     = "invalid_blocked_by"
+	CheckCycle         = "blocked_by_cycle"
+	CheckClosedAt      = "closed_at"
+	CheckBlockedReason = "blocked_reason"
+)
+
+// Problem is one violated invariant found by Doctor.
+type Problem struct {
+	Check   string   `json:"check"`
+	IssueID string   `json:"issue_id,omitempty"`
+	IDs     []string `json:"ids,omitempty"`
+	Message string   `json:"message"`
+	// Fixable problems are repaired by Doctor when fix is set; Fixed
+	// reports whether that happened.
+	Fixable bool `json:"fixable"`
+	Fixed   bool `json:"fixed"`
+}
+
+// doctorRow is an issue read without scanIssue, so malformed values are
+// reported instead of failing the read.
+type doctorRow struct {
+	id            string
+	category      string
+	state         string
+	parentID      sql.NullString
+	blockedBy     []string
+	blockedReason sql.NullString
+	closedAt      sql.NullString
+	lastUpdatedAt string
+	version       int64
+
+	// deps is blocked_by with every invalid entry removed.
+	deps []string
+}
+
+// Doctor checks the invariants the service relies on: SQLite integrity and
+// foreign keys, issue IDs, categories and states, the project > workstream >
+// task hierarchy, blocked_by references and cycles, and the closed_at and
+// blocked_reason fields that state transitions maintain. With fix set,
+// fixable problems are repaired in one transaction; each repair bumps the
+// issue's version and records a history event. Problems that need a human
+// decision, such as an orphaned task, are only reported.
+func (s *Service) Doctor(ctx context.Context, fix bool) ([]Problem, error) {
+	problems, err := s.integrityProblems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := doctorRowsTx(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*doctorRow, len(rows))
+	for _, r := range rows {
+		byID[r.id] = r
+	}
+
+	for _, r := range rows {
+		found, err := s.checkIssueTx(ctx, tx, r, byID, fix)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, found...)
+	}
+	problems = append(problems, blockedByCycles(rows)...)
+
+	if fix {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return problems, nil
+}
+
+func (s *Service) integrityProblems(ctx context.Context) ([]Problem, error) {
+	var out []Problem
+	rows, err := s.db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if line != "ok" {
+			out = append(out, Problem{Check: CheckIntegrity, Message: line})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT "table", parent, COUNT(1) FROM pragma_foreign_key_check GROUP BY "table", parent ORDER BY "table", parent`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, parent string
+		var n int
+		if err := rows.Scan(&table, &parent, &n); err != nil {
+			return nil, err
+		}
+		out = append(out, Problem{Check: CheckIntegrity, Message: fmt.Sprintf("%d row(s) in %s reference missing %s rows", n, table, parent)})
+	}
+	return out, rows.Err()
+}
+
+func doctorRowsTx(ctx context.Context, tx *sql.Tx) ([]*doctorRow, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, category, state, parent_id, blocked_reason, closed_at, last_updated_at, version
+		FROM issues
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*doctorRow
+	for rows.Next() {
+		r := &doctorRow{}
+		if err := rows.Scan(&r.id, &r.category, &r.state, &r.parentID, &r.blockedReason, &r.closedAt, &r.lastUpdatedAt, &r.version); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	byID := make(map[string]*doctorRow, len(out))
+	for _, r := range out {
+		byID[r.id] = r
+	}
+	deps, err := tx.QueryContext(ctx, `SELECT issue_id, depends_on_id FROM issue_dependencies ORDER BY issue_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer deps.Close()
+	for deps.Next() {
+		var id, dep string
+		if err := deps.Scan(&id, &dep); err != nil {
+			return nil, err
+		}
+		// Rows of missing issues are foreign key violations, reported by
+		// the integrity check.
+		if r := byID[id]; r != nil {
+			r.blockedBy = append(r.blockedBy, dep)
+		}
+	}
+	return out, deps.Err()
+}
+
+func (s *Service) checkIssueTx(ctx context.Context, tx *sql.Tx, r *doctorRow, byID map[string]*doctorRow, fix bool) ([]Problem, error) {
+	var out []Problem
+	report := func(check string, fixable bool, ids []string, format string, args ...any) *Problem {
+		out = append(out, Problem{Check: check, IssueID: r.id, IDs: ids, Message: fmt.Sprintf(format, args...), Fixable: fixable})
+		return &out[len(out)-1]
+	}
+	prefix, _ := projectPrefixFromIssueID(r.id)
+
+	if !issueIDRe.MatchString(r.id) {
+		report(CheckIssueID, false, nil, "id %q does not match <prefix>-<number>", r.id)
+	}
+	category := Category(r.category)
+	if !IsValidCategory(category) {
+		report(CheckCategory, false, nil, "unknown category %q", r.category)
+	}
+	state := State(r.state)
+	if !IsValidState(state) {
+		report(CheckState, false, nil, "unknown state %q", r.state)
+	}
+
+	// Hierarchy, as CreateIssue and SetParent enforce it.
+	if want, needsParent := expectedParentCategory(category); IsValidCategory(category) {
+		switch {
+		case !needsParent && r.parentID.Valid:
+			p := report(CheckParent, true, []string{r.parentID.String}, "%s cannot have a parent, has %s", category, r.parentID.String)
+			if fix {
+				if err := s.repairTx(ctx, tx, r, "parent_id", nil, EventParent, &r.parentID.String, nil); err != nil {
+					return nil, err
+				}
+				r.parentID = sql.NullString{}
+				p.Fixed = true
+			}
+		case needsParent && !r.parentID.Valid:
+			report(CheckOrphan, false, nil, "%s has no parent %s", category, want)
+		case needsParent:
+			pid := r.parentID.String
+			parent := byID[pid]
+			if parent == nil {
+				report(CheckParent, false, []string{pid}, "parent %s does not exist", pid)
+			} else if Category(parent.category) != want {
+				report(CheckParent, false, []string{pid}, "%s parent %s is a %s, not a %s", category, pid, parent.category, want)
+			} else if parentPrefix, _ := projectPrefixFromIssueID(pid); parentPrefix != prefix {
+				report(CheckParent, false, []string{pid}, "parent %s is in another project", pid)
+			}
+		}
+	}
+
+	// blocked_by, as normalizeBlockedByTx enforces it. The foreign keys
+	// only guarantee existence while they are enforced.
+	dirty := false
+	for _, id := range r.blockedBy {
+		depPrefix, _ := projectPrefixFromIssueID(id)
+		switch {
+		case id == r.id:
+			report(CheckBlockedBy, true, []string{id}, "blocked_by includes itself")
+		case byID[id] == nil:
+			report(CheckBlockedBy, true, []string{id}, "blocked_by references missing issue %s", id)
+		case depPrefix != prefix:
+			report(CheckBlockedBy, true, []string{id}, "blocked_by references %s in another project", id)
+		default:
+			r.deps = append(r.deps, id)
+			continue
+		}
+		dirty = true
+	}
+	if r.deps == nil {
+		r.deps = []string{}
+	}
+	if dirty && fix {
+		oldValue, err := blockedByEventValue(r.blockedBy)
+		if err != nil {
+			return nil, err
+		}
+		keptJSON, err := json.Marshal(r.deps)
+		if err != nil {
+			return nil, fmt.Errorf("marshal blocked_by: %w", err)
+		}
+		if err := setDependenciesTx(ctx, tx, r.id, r.deps); err != nil {
+			return nil, err
+		}
+		if err := s.repairTx(ctx, tx, r, "", nil, EventBlockedBy, oldValue, stringPtr(string(keptJSON))); err != nil {
+			return nil, err
+		}
+		markFixed(out, CheckBlockedBy)
+	}
+
+	// closed_at and blocked_reason, as TransitionState maintains them.
+	if IsValidState(state) {
+		closed := state == StateDone || state == StateCanceled
+		switch {
+		case !closed && r.closedAt.Valid:
+			p := report(CheckClosedAt, true, nil, "%s issue has closed_at %s", state, r.closedAt.String)
+			if fix {
+				if err := s.repairTx(ctx, tx, r, "closed_at", nil, EventRepair, repairValue("closed_at", &r.closedAt.String), repairValue("closed_at", nil)); err != nil {
+					return nil, err
+				}
+				p.Fixed = true
+			}
+		case closed && !r.closedAt.Valid:
+			p := report(CheckClosedAt, true, nil, "%s issue has no closed_at", state)
+			if fix {
+				if err := s.repairTx(ctx, tx, r, "closed_at", &r.lastUpdatedAt, EventRepair, repairValue("closed_at", nil), repairValue("closed_at", &r.lastUpdatedAt)); err != nil {
+					return nil, err
+				}
+				p.Fixed = true
+			}
+		}
+		switch {
+		case state != StateBlocked && r.blockedReason.Valid:
+			p := report(CheckBlockedReason, true, nil, "%s issue has blocked_reason %q", state, r.blockedReason.String)
+			if fix {
+				if err := s.repairTx(ctx, tx, r, "blocked_reason", nil, EventRepair, repairValue("blocked_reason", &r.blockedReason.String), repairValue("blocked_reason", nil)); err != nil {
+					return nil, err
+				}
+				p.Fixed = true
+			}
+		case state == StateBlocked && strings.TrimSpace(r.blockedReason.String) == "":
+			report(CheckBlockedReason, false, nil, "blocked issue has no blocked_reason")
+		}
+	}
+	return out, nil
+}
+
+func markFixed(problems []Problem, check string) {
+	for i := range problems {
+		if problems[i].Check == check && problems[i].Fixable {
+			problems[i].Fixed = true
+		}
+	}
+}
+
+// repairTx sets one column of r to value (nil for NULL), bumping its
+// version and recording a history event. column is always a constant, or
+// empty when the repair changed another table.
+func (s *Service) repairTx(ctx context.Context, tx *sql.Tx, r *doctorRow, column string, value *string, kind EventKind, oldValue, newValue *string) error {
+	set := "version = version + 1, last_updated_at = CURRENT_TIMESTAMP"
+	args := []any{r.id}
+	if column != "" {
+		set = column + " = ?, " + set
+		args = append([]any{nullableString(value)}, args...)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE issues SET "+set+" WHERE id = ?", args...); err != nil {
+		return fmt.Errorf("repair %s: %w", r.id, err)
+	}
+	r.version++
+	return recordEventTx(ctx, tx, r.id, kind, oldValue, newValue, r.version, s.actor)
+}
+
+// repairValue formats a repaired field for a repair event as field=value,
+// with "null" for no value.
+func repairValue(field string, value *string) *string {
+	if value == nil {
+		return stringPtr(field + "=null")
+	}
+	return stringPtr(field + "=" + *value)
+}
+
+// blockedByCycles reports each cycle in the valid blocked_by entries once.
+// Cycles are not fixed, since any of their edges could be the wrong one.
+func blockedByCycles(rows []*doctorRow) []Problem {
+	byID := make(map[string]*doctorRow, len(rows))
+	for _, r := range rows {
+		byID[r.id] = r
+	}
+	const (
+		unvisited = iota
+		active
+		finished
+	)
+	status := make(map[string]int, len(rows))
+	var out []Problem
+	var stack []string
+	var walk func(id string)
+	walk = func(id string) {
+		status[id] = active
+		stack = append(stack, id)
+		for _, dep := range byID[id].deps {
+			switch status[dep] {
+			case unvisited:
+				walk(dep)
+			case active:
+				start := 0
+				for stack[start] != dep {
+					start++
+				}
+				cycle := append(append([]string(nil), stack[start:]...), dep)
+				out = append(out, Problem{Check: CheckCycle, IssueID: dep, IDs: cycle, Message: "blocked_by cycle: " + strings.Join(cycle, " -> ")})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		status[id] = finished
+	}
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if status[id] == unvisited {
+			walk(id)
+		}
+	}
+	return out
+}
@@ -1,6 +1,9 @@
 package issues
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrInvalidInput           = errors.New("invalid input")
@@ -10,3 +13,69 @@ var (
 	ErrDepthExceeded          = errors.New("depth exceeded")
 	ErrCycleDetected          = errors.New("cycle detected")
 )
+
+// Error adds machine-readable detail to one of the sentinel errors above,
+// which it unwraps to, so errors.Is keeps working.
+type Error struct {
+	Kind    error  // one of the sentinel errors
+	Message string // human-readable detail, without the sentinel prefix
+
+	Field string   // offending input field, if any
+	IDs   []string // issues involved, e.g. unresolved dependencies or a cycle path
+
+	// ExpectedVersion and CurrentVersion are set on stale writes.
+	ExpectedVersion *int64
+	CurrentVersion  *int64
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrInvalidInput, "invalid_input"},
+	{ErrInvalidStateTransition, "invalid_state_transition"},
+	{ErrNotFound, "not_found"},
+	{ErrConflict, "conflict"},
+	{ErrDepthExceeded, "depth_exceeded"},
+	{ErrCycleDetected, "cycle_detected"},
+}
+
+// ErrorCode returns a stable snake_case code for err, or "internal" when it
+// does not wrap any of the sentinel errors.
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return "internal"
+}
+
+// invalidField reports bad input in the named field.
+func invalidField(field, format string, args ...any) error {
+	return &Error{Kind: ErrInvalidInput, Message: fmt.Sprintf(format, args...), Field: field}
+}
+
+func notFoundError(id string) error {
+	return &Error{Kind: ErrNotFound, Message: fmt.Sprintf("issue %q not found", id), IDs: []string{id}}
+}
+
+// staleWriteError reports an optimistic-concurrency failure along with the
+// version the caller must re-read.
+func staleWriteError(id string, expected, current int64) error {
+	return &Error{
+		Kind:            ErrConflict,
+		Message:         fmt.Sprintf("stale write; expected version %d", expected),
+		IDs:             []string{id},
+		ExpectedVersion: &expected,
+		CurrentVersion:  &current,
+	}
+}
@@ -0,0 +1,255 @@
+package issues
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var relativeTimeRe = regexp.MustCompile(`^([0-9]+)([mhdw])$`)
+
+// unresolvedDepCond is true when the dependency dep still blocks.
+const unresolvedDepCond = "dep.state != 'done'"
+
+// unresolvedDepsExpr is true when an issue has a blocked_by entry that
+// still blocks.
+const unresolvedDepsExpr = `EXISTS (
+	SELECT 1 FROM issue_dependencies d
+	JOIN issues dep ON dep.id = d.depends_on_id
+	WHERE d.issue_id = issues.id AND ` + unresolvedDepCond + `
+)`
+
+var sortColumns = map[SortField]string{
+	SortCreated: "created_at",
+	SortUpdated: "last_updated_at",
+	SortClosed:  "COALESCE(closed_at, '')",
+	SortID:      "substr(id, 1, 3)",
+	SortTitle:   "title COLLATE NOCASE",
+	SortState:   "state",
+}
+
+func IsValidSortField(f SortField) bool {
+	_, ok := sortColumns[f]
+	return ok
+}
+
+// ParseTimeBound parses an absolute date (2006-01-02), an RFC 3339 timestamp,
+// or a relative age such as 30m, 12h, 7d or 2w counted back from now.
+func ParseTimeBound(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if m := relativeTimeRe.FindStringSubmatch(value); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: invalid time %q", ErrInvalidInput, value)
+		}
+		unit := map[string]time.Duration{
+			"m": time.Minute,
+			"h": time.Hour,
+			"d": 24 * time.Hour,
+			"w": 7 * 24 * time.Hour,
+		}[m[2]]
+		return now.Add(-time.Duration(n) * unit).UTC(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.UTC); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid time %q (use YYYY-MM-DD, RFC 3339 or an age like 7d)", ErrInvalidInput, value)
+}
+
+// whereClause builds the SQL condition for the filter. actor resolves "me"
+// in the query expression.
+func (f ListFilter) whereClause(actor string) (string, []any, error) {
+	conds := []string{"1=1"}
+	args := make([]any, 0, 8)
+	query, err := compileQuery(f.Query, time.Now(), actor)
+	if err != nil {
+		return "", nil, err
+	}
+	conds = append(conds, query.conds...)
+	args = append(args, query.args...)
+	if p := strings.TrimSpace(f.ProjectPrefix); p != "" {
+		conds = append(conds, "id LIKE ?")
+		args = append(args, strings.ToLower(p)+"-%")
+	}
+	if len(f.States) > 0 {
+		for _, st := range f.States {
+			if !IsValidState(st) {
+				return "", nil, invalidField("state", "unknown state %q", st)
+			}
+			args = append(args, string(st))
+		}
+		conds = append(conds, fmt.Sprintf("state IN (%s)", placeholders(len(f.States))))
+	}
+	if len(f.Categories) > 0 {
+		for _, c := range f.Categories {
+			if !IsValidCategory(c) {
+				return "", nil, invalidField("category", "unknown category %q", c)
+			}
+			args = append(args, string(c))
+		}
+		conds = append(conds, fmt.Sprintf("category IN (%s)", placeholders(len(f.Categories))))
+	}
+	if p := strings.TrimSpace(f.ParentID); p != "" {
+		conds = append(conds, "parent_id = ?")
+		args = append(args, p)
+	}
+	if a := strings.TrimSpace(f.AncestorID); a != "" {
+		conds = append(conds, `id IN (
+			WITH RECURSIVE sub(id) AS (
+				SELECT id FROM issues WHERE parent_id = ?
+				UNION
+				SELECT i.id FROM issues i JOIN sub ON i.parent_id = sub.id
+			)
+			SELECT id FROM sub
+		)`)
+		args = append(args, a)
+	}
+	if a := strings.TrimSpace(f.Assignee); a != "" {
+		conds = append(conds, "assignee = ?")
+		args = append(args, a)
+	}
+	if len(f.AnyLabels) > 0 {
+		labels, err := normalizeLabels(f.AnyLabels)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, fmt.Sprintf("id IN (SELECT issue_id FROM issue_labels WHERE label IN (%s))", placeholders(len(labels))))
+		for _, l := range labels {
+			args = append(args, l)
+		}
+	}
+	if len(f.AllLabels) > 0 {
+		labels, err := normalizeLabels(f.AllLabels)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, fmt.Sprintf("(SELECT COUNT(1) FROM issue_labels WHERE issue_id = issues.id AND label IN (%s)) = ?", placeholders(len(labels))))
+		for _, l := range labels {
+			args = append(args, l)
+		}
+		args = append(args, len(labels))
+	}
+
+	bounds := []struct {
+		column string
+		op     string
+		value  *time.Time
+	}{
+		{"created_at", ">=", f.CreatedAfter},
+		{"created_at", "<", f.CreatedBefore},
+		{"last_updated_at", ">=", f.UpdatedAfter},
+		{"last_updated_at", "<", f.UpdatedBefore},
+		{"closed_at", ">=", f.ClosedAfter},
+		{"closed_at", "<", f.ClosedBefore},
+	}
+	for _, b := range bounds {
+		if b.value == nil {
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("%s %s ?", b.column, b.op))
+		args = append(args, b.value.UTC().Format(sqliteTimeLayout))
+	}
+
+	if f.HasUnresolvedDeps != nil {
+		if *f.HasUnresolvedDeps {
+			conds = append(conds, unresolvedDepsExpr)
+		} else {
+			conds = append(conds, "NOT "+unresolvedDepsExpr)
+		}
+	}
+	if !f.IncludeArchived && !query.archived {
+		conds = append(conds, "archived_at IS NULL")
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// sortKey returns the SQL expression for the primary sort column.
+func (f ListFilter) sortKey() (string, error) {
+	column, ok := sortColumns[f.sortField()]
+	if !ok {
+		return "", invalidField("sort", "unknown sort field %q (use created|updated|closed|id|title|state)", f.Sort)
+	}
+	return column, nil
+}
+
+func (f ListFilter) sortField() SortField {
+	if f.Sort == "" {
+		return SortCreated
+	}
+	return f.Sort
+}
+
+// orderByClause orders by the sort key, then by issue number and ID so that
+// every row has a unique position for keyset pagination.
+func (f ListFilter) orderByClause(sortKey string) string {
+	dir := "ASC"
+	if f.Reverse {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s %s, id %s", sortKey, dir, issueNumberExpr, dir, dir)
+}
+
+// cursorClause restricts the query to rows after the cursor position.
+func (f ListFilter) cursorClause(sortKey string) (string, []any, error) {
+	c, err := decodeCursor(f.Cursor)
+	if err != nil {
+		return "", nil, err
+	}
+	if c.Sort != f.sortField() || c.Reverse != f.Reverse {
+		return "", nil, invalidField("cursor", "cursor was issued for a different sort order")
+	}
+	op := ">"
+	if f.Reverse {
+		op = "<"
+	}
+	number, _ := issueNumber(c.ID)
+	cond := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND (%[3]s %[2]s ? OR (%[3]s = ? AND id %[2]s ?))))", sortKey, op, issueNumberExpr)
+	return cond, []any{c.Key, c.Key, number, number, c.ID}, nil
+}
+
+type listCursor struct {
+	Sort    SortField `json:"s"`
+	Reverse bool      `json:"r,omitempty"`
+	Key     string    `json:"k"`
+	ID      string    `json:"i"`
+}
+
+func encodeCursor(f ListFilter, key, id string) (string, error) {
+	raw, err := json.Marshal(listCursor{Sort: f.sortField(), Reverse: f.Reverse, Key: key, ID: id})
+	if err != nil {
+		return "", fmt.Errorf("encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(value string) (listCursor, error) {
+	var c listCursor
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return c, invalidField("cursor", "malformed cursor")
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == "" {
+		return c, invalidField("cursor", "malformed cursor")
+	}
+	return c, nil
+}
+
+// issueNumber returns the numeric part of an issue ID.
+func issueNumber(id string) (int64, bool) {
+	_, num, ok := strings.Cut(id, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
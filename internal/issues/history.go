@@ -0,0 +1,91 @@
+package issues
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// History returns every recorded event for an issue, oldest first. The
+// history of a deleted issue, ending in its delete event, stays readable.
+func (s *Service) History(ctx context.Context, id string) ([]Event, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, issue_id, kind, old_value, new_value, version, actor, created_at
+		FROM issue_events
+		WHERE issue_id = ?
+		ORDER BY id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Event, 0)
+	for rows.Next() {
+		var ev Event
+		var oldValue, newValue sql.NullString
+		var created string
+		if err := rows.Scan(&ev.ID, &ev.IssueID, &ev.Kind, &oldValue, &newValue, &ev.Version, &ev.Actor, &created); err != nil {
+			return nil, err
+		}
+		if oldValue.Valid {
+			v := oldValue.String
+			ev.OldValue = &v
+		}
+		if newValue.Valid {
+			v := newValue.String
+			ev.NewValue = &v
+		}
+		createdAt, err := parseSQLiteTime(created)
+		if err != nil {
+			return nil, err
+		}
+		ev.CreatedAt = createdAt
+		out = append(out, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		if _, err := getIssueByIDDB(ctx, s.db, id); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func recordEventTx(ctx context.Context, tx *sql.Tx, issueID string, kind EventKind, oldValue, newValue *string, version int64, actor string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO issue_events(issue_id, kind, old_value, new_value, version, actor)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, issueID, string(kind), nullableString(oldValue), nullableString(newValue), version, actor)
+	if err != nil {
+		return fmt.Errorf("record %s event for %s: %w", kind, issueID, err)
+	}
+	return nil
+}
+
+func nullableString(v *string) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
+
+func blockedByEventValue(ids []string) (*string, error) {
+	raw, err := json.Marshal(ids)
+	if err != nil {
+		return nil, fmt.Errorf("marshal blocked_by: %w", err)
+	}
+	return stringPtr(string(raw)), nil
+}
@@ -0,0 +1,123 @@
+package issues
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var labelRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,49}$`)
+
+// AddLabels attaches labels to an issue. Labels it already has are ignored.
+func (s *Service) AddLabels(ctx context.Context, id string, labels []string) (*Issue, error) {
+	return s.changeLabels(ctx, id, labels, `INSERT OR IGNORE INTO issue_labels(issue_id, label) VALUES (?, ?)`)
+}
+
+// RemoveLabels detaches labels from an issue. Labels it does not have are
+// ignored.
+func (s *Service) RemoveLabels(ctx context.Context, id string, labels []string) (*Issue, error) {
+	return s.changeLabels(ctx, id, labels, `DELETE FROM issue_labels WHERE issue_id = ? AND label = ?`)
+}
+
+func (s *Service) changeLabels(ctx context.Context, id string, labels []string, stmt string) (*Issue, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	normalized, err := normalizeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	if len(normalized) == 0 {
+		return nil, invalidField("labels", "at least one label is required")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issue, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range normalized {
+		if _, err := tx.ExecContext(ctx, stmt, id, label); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if equalStrings(issue.Labels, current.Labels) {
+		return current, tx.Commit()
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE issues SET version = version + 1, last_updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	updated, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	oldValue, err := json.Marshal(issue.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("marshal labels: %w", err)
+	}
+	newValue, err := json.Marshal(updated.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("marshal labels: %w", err)
+	}
+	if err := recordEventTx(ctx, tx, id, EventLabels, stringPtr(string(oldValue)), stringPtr(string(newValue)), updated.Version, s.actor); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// normalizeLabels lowercases, validates, de-duplicates and sorts labels.
+func normalizeLabels(labels []string) ([]string, error) {
+	seen := make(map[string]bool, len(labels))
+	out := make([]string, 0, len(labels))
+	for _, raw := range labels {
+		label := strings.ToLower(strings.TrimSpace(raw))
+		if label == "" {
+			continue
+		}
+		if !labelRe.MatchString(label) {
+			return nil, invalidField("labels", "invalid label %q (use lowercase letters, digits, '.', '_', ':' or '-', up to 50 chars)", label)
+		}
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+		out = append(out, label)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,395 @@
+package issues
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var queryFieldRe = regexp.MustCompile(`^[a-z_]+$`)
+
+// queryOps lists the comparison operators, longest first so that ">=" wins
+// over ">".
+var queryOps = []string{"!=", ">=", "<=", ":", "=", ">", "<"}
+
+var queryTimeColumns = map[string]string{
+	"created": "created_at",
+	"updated": "last_updated_at",
+	"closed":  "closed_at",
+}
+
+var queryCategoryShortcuts = map[string]Category{
+	"p": CategoryProject,
+	"w": CategoryWorkstream,
+	"t": CategoryTask,
+}
+
+// compiledQuery is a query expression translated to SQL conditions over the
+// issues table.
+type compiledQuery struct {
+	conds []string
+	args  []any
+	// archived is set when the query filters on archived itself, so the
+	// default "archived_at IS NULL" must not be added.
+	archived bool
+}
+
+type queryToken struct {
+	text   string
+	column int // 1-based byte offset in the query
+}
+
+// compileQuery parses a query such as
+//
+//	state:todo,in_progress category:task parent:cat-2 updated>7d blocked:false
+//
+// Terms are separated by whitespace and all must match. A term is either
+// field<op>value or a bare word matched against the title. ":" and "="
+// accept a comma-separated list of alternatives and "!=" excludes them;
+// created, updated and closed compare with <, <=, > and >= against a time
+// in the formats accepted by ParseTimeBound. Values may be double-quoted to
+// include spaces, commas or other punctuation; inside quotes a backslash
+// escapes the next character, as in title:"say \"hi\"". "me" in assignee
+// refers to actor.
+func compileQuery(query string, now time.Time, actor string) (compiledQuery, error) {
+	var q compiledQuery
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return q, err
+	}
+	for _, tok := range tokens {
+		if err := q.addTerm(tok, now, actor); err != nil {
+			return compiledQuery{}, err
+		}
+	}
+	return q, nil
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	start := -1
+	quoteAt := -1
+	escaped := false
+	for i, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoteAt >= 0:
+			escaped = true
+		case r == '"':
+			if start < 0 {
+				start = i
+			}
+			if quoteAt >= 0 {
+				quoteAt = -1
+			} else {
+				quoteAt = i
+			}
+		case (r == ' ' || r == '\t' || r == '\n') && quoteAt < 0:
+			if start >= 0 {
+				tokens = append(tokens, queryToken{text: query[start:i], column: start + 1})
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if quoteAt >= 0 {
+		return nil, invalidField("query", "query: unterminated quote at column %d", quoteAt+1)
+	}
+	if start >= 0 {
+		tokens = append(tokens, queryToken{text: query[start:], column: start + 1})
+	}
+	return tokens, nil
+}
+
+func (t queryToken) errorf(format string, args ...any) error {
+	return invalidField("query", "query: %q at column %d: %s", t.text, t.column, fmt.Sprintf(format, args...))
+}
+
+// split separates a term into field, operator and raw value. Terms without
+// an operator before any quote are bare words.
+func (t queryToken) split() (field, op, value string, ok bool) {
+	idx := strings.IndexAny(t.text, `:=!<>"`)
+	if idx <= 0 || t.text[idx] == '"' {
+		return "", "", t.text, false
+	}
+	rest := t.text[idx:]
+	for _, candidate := range queryOps {
+		if strings.HasPrefix(rest, candidate) {
+			return t.text[:idx], candidate, rest[len(candidate):], true
+		}
+	}
+	return t.text[:idx], "", rest, true
+}
+
+// values returns the comma-separated alternatives of a raw value. Each
+// alternative may be double-quoted on its own.
+func (t queryToken) values(raw string) ([]string, error) {
+	var out []string
+	for rest := raw; ; rest = rest[1:] {
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			unquoted, n, ok := unquoteQueryValue(rest)
+			if !ok {
+				return nil, t.errorf("malformed quoted value")
+			}
+			v, rest = unquoted, rest[n:]
+			if rest != "" && rest[0] != ',' {
+				return nil, t.errorf("quotes must enclose the whole value")
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			v, rest = strings.TrimSpace(rest[:end]), rest[end:]
+			if strings.Contains(v, `"`) {
+				return nil, t.errorf("quotes must enclose the whole value")
+			}
+			if v == "" {
+				return nil, t.errorf("empty value")
+			}
+		}
+		out = append(out, v)
+		if rest == "" {
+			return out, nil
+		}
+	}
+}
+
+// unquoteQueryValue reads the quoted value at the start of s, in which a
+// backslash escapes the next character. It returns the value and the number
+// of bytes consumed.
+func unquoteQueryValue(s string) (string, int, bool) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, false
+			}
+			i++
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), i + 1, true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
+
+// word returns a raw value as a single string, unquoting it if needed.
+func (t queryToken) word(raw string) (string, error) {
+	if strings.HasPrefix(raw, `"`) {
+		value, n, ok := unquoteQueryValue(raw)
+		if !ok {
+			return "", t.errorf("malformed quoted value")
+		}
+		if n != len(raw) {
+			return "", t.errorf("quotes must enclose the whole value")
+		}
+		return value, nil
+	}
+	if strings.Contains(raw, `"`) {
+		return "", t.errorf("quotes must enclose the whole value")
+	}
+	return raw, nil
+}
+
+func (q *compiledQuery) add(cond string, args ...any) {
+	q.conds = append(q.conds, cond)
+	q.args = append(q.args, args...)
+}
+
+func (q *compiledQuery) addTerm(tok queryToken, now time.Time, actor string) error {
+	field, op, raw, ok := tok.split()
+	if !ok {
+		word, err := tok.word(raw)
+		if err != nil {
+			return err
+		}
+		q.add("instr(lower(title), lower(?)) > 0", word)
+		return nil
+	}
+	if !queryFieldRe.MatchString(field) {
+		return tok.errorf("invalid field name %q", field)
+	}
+	if op == "" {
+		return tok.errorf("unknown operator (use : = != < <= > >=)")
+	}
+	if raw == "" {
+		return tok.errorf("missing value")
+	}
+
+	if column, isTime := queryTimeColumns[field]; isTime {
+		switch op {
+		case "<", "<=", ">", ">=":
+		default:
+			return tok.errorf("%s compares with < <= > >=, e.g. %s>7d", field, field)
+		}
+		value, err := tok.word(raw)
+		if err != nil {
+			return err
+		}
+		t, err := ParseTimeBound(value, now)
+		if err != nil {
+			return tok.errorf("invalid time %q (use YYYY-MM-DD, RFC 3339 or an age like 7d)", value)
+		}
+		q.add(fmt.Sprintf("%s %s ?", column, op), t.UTC().Format(sqliteTimeLayout))
+		return nil
+	}
+
+	if op != ":" && op != "=" && op != "!=" {
+		return tok.errorf("%s does not support %q (use : = !=)", field, op)
+	}
+	negate := op == "!="
+	values, err := tok.values(raw)
+	if err != nil {
+		return err
+	}
+
+	var cond string
+	var args []any
+	switch field {
+	case "state":
+		for _, v := range values {
+			if !IsValidState(State(v)) {
+				return tok.errorf("unknown state %q", v)
+			}
+			args = append(args, v)
+		}
+		cond = fmt.Sprintf("state IN (%s)", placeholders(len(args)))
+	case "category":
+		for _, v := range values {
+			c := Category(v)
+			if shortcut, ok := queryCategoryShortcuts[v]; ok {
+				c = shortcut
+			}
+			if !IsValidCategory(c) {
+				return tok.errorf("unknown category %q", v)
+			}
+			args = append(args, string(c))
+		}
+		cond = fmt.Sprintf("category IN (%s)", placeholders(len(args)))
+	case "id":
+		for _, v := range values {
+			args = append(args, strings.ToLower(v))
+		}
+		cond = fmt.Sprintf("id IN (%s)", placeholders(len(args)))
+	case "project":
+		for _, v := range values {
+			args = append(args, strings.ToLower(v))
+		}
+		cond = fmt.Sprintf("substr(id, 1, instr(id, '-') - 1) IN (%s)", placeholders(len(args)))
+	case "parent":
+		cond, args = nullableInCond("parent_id", values)
+	case "assignee":
+		for i, v := range values {
+			if v == "me" {
+				if strings.TrimSpace(actor) == "" {
+					return tok.errorf(`"me" needs an actor; pass --actor or set IT_ACTOR`)
+				}
+				values[i] = actor
+			}
+		}
+		cond, args = nullableInCond("assignee", values)
+	case "label":
+		for _, v := range values {
+			label := strings.ToLower(v)
+			if !labelRe.MatchString(label) {
+				return tok.errorf("invalid label %q", v)
+			}
+			args = append(args, label)
+		}
+		cond = fmt.Sprintf("id IN (SELECT issue_id FROM issue_labels WHERE label IN (%s))", placeholders(len(args)))
+	case "under":
+		if negate || len(values) != 1 {
+			return tok.errorf("under takes a single issue ID with : or =")
+		}
+		cond = `id IN (
+			WITH RECURSIVE sub(id) AS (
+				SELECT id FROM issues WHERE parent_id = ?
+				UNION
+				SELECT i.id FROM issues i JOIN sub ON i.parent_id = sub.id
+			)
+			SELECT id FROM sub
+		)`
+		args = []any{values[0]}
+	case "title":
+		word, err := tok.word(raw)
+		if err != nil {
+			return err
+		}
+		cond = "instr(lower(title), lower(?)) > 0"
+		args = []any{word}
+	case "blocked", "archived":
+		b, err := tok.boolValue(values)
+		if err != nil {
+			return err
+		}
+		if negate {
+			b = !b
+		}
+		if field == "blocked" {
+			cond = unresolvedDepsExpr
+			if !b {
+				cond = "NOT " + cond
+			}
+		} else {
+			q.archived = true
+			cond = "archived_at IS NOT NULL"
+			if !b {
+				cond = "archived_at IS NULL"
+			}
+		}
+		q.add(cond)
+		return nil
+	default:
+		return tok.errorf("unknown field %q (use state|category|id|project|parent|under|assignee|label|title|created|updated|closed|blocked|archived)", field)
+	}
+
+	if negate {
+		cond = "NOT (" + cond + ")"
+	}
+	q.add(cond, args...)
+	return nil
+}
+
+func (t queryToken) boolValue(values []string) (bool, error) {
+	if len(values) == 1 {
+		switch values[0] {
+		case "true", "yes":
+			return true, nil
+		case "false", "no":
+			return false, nil
+		}
+	}
+	return false, t.errorf("expected true or false")
+}
+
+// nullableInCond matches a nullable column against values, where "none"
+// matches NULL. IFNULL keeps the result two-valued so that NOT works.
+func nullableInCond(column string, values []string) (string, []any) {
+	var args []any
+	matchNull := false
+	for _, v := range values {
+		if v == "none" {
+			matchNull = true
+			continue
+		}
+		args = append(args, v)
+	}
+	var parts []string
+	if len(args) > 0 {
+		parts = append(parts, fmt.Sprintf("IFNULL(%s IN (%s), 0)", column, placeholders(len(args))))
+	}
+	if matchNull {
+		parts = append(parts, column+" IS NULL")
+	}
+	return "(" + strings.Join(parts, " OR ") + ")", args
+}
@@ -0,0 +1,54 @@
+package issues
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// openDependentsExpr counts the unfinished issues whose blocked_by includes
+// issues.id, that is, the work finishing it would move forward.
+const openDependentsExpr = `(
+	SELECT COUNT(1)
+	FROM issue_dependencies d
+	JOIN issues w ON w.id = d.issue_id
+	WHERE d.depends_on_id = issues.id AND w.state NOT IN ('done', 'canceled')
+)`
+
+// ReadyIssues returns unassigned, unarchived todo tasks whose blocked_by
+// dependencies are all done. Tasks that block the most unfinished issues come
+// first, then the oldest. A limit of zero or less returns every ready task.
+func (s *Service) ReadyIssues(ctx context.Context, projectPrefix string, limit int) ([]Issue, error) {
+	conds := []string{"state = ?", "category = ?", "assignee IS NULL", "archived_at IS NULL", "NOT " + unresolvedDepsExpr}
+	args := []any{string(StateTodo), string(CategoryTask)}
+	if p := strings.TrimSpace(projectPrefix); p != "" {
+		conds = append(conds, "id LIKE ?")
+		args = append(args, strings.ToLower(p)+"-%")
+	}
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM issues
+		WHERE %s
+		ORDER BY %s DESC, created_at ASC, %s ASC, id ASC
+	`, issueSelectColumns, strings.Join(conds, " AND "), openDependentsExpr, issueNumberExpr)
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Issue, 0)
+	for rows.Next() {
+		issue, err := scanIssue(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, issue)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,95 @@
+package issues
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Search runs a full-text query over titles, bodies and comments and returns
+// matches best first. Every whitespace-separated term must match; a trailing
+// * makes a term a prefix match. The filter narrows results the same way it
+// does for ListIssues; its sort and cursor fields are not supported.
+func (s *Service) Search(ctx context.Context, query string, filter ListFilter) ([]SearchResult, error) {
+	match, err := ftsQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Cursor != "" || filter.Sort != "" || filter.Reverse {
+		return nil, fmt.Errorf("%w: search results are ordered by relevance and cannot be sorted or paged", ErrInvalidInput)
+	}
+	if filter.Limit < 0 {
+		return nil, invalidField("limit", "limit cannot be negative")
+	}
+	where, args, err := filter.whereClause(s.actor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Title hits outweigh body hits, which outweigh comment hits.
+	q := fmt.Sprintf(`
+		SELECT %s, m.rank, m.snippet
+		FROM issues
+		JOIN (
+			SELECT issue_id,
+				bm25(issues_fts, 0.0, 10.0, 5.0, 1.0) AS rank,
+				snippet(issues_fts, -1, '[', ']', '...', 12) AS snippet
+			FROM issues_fts
+			WHERE issues_fts MATCH ?
+		) m ON m.issue_id = issues.id
+		WHERE %s
+		ORDER BY m.rank ASC, %s ASC
+	`, issueSelectColumns, where, issueNumberExpr)
+	args = append([]any{match}, args...)
+	if filter.Limit > 0 {
+		q += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SearchResult, 0)
+	for rows.Next() {
+		var r SearchResult
+		issue, err := scanIssue(extraScanner{row: rows, extra: []any{&r.Rank, &r.Snippet}})
+		if err != nil {
+			return nil, err
+		}
+		r.Issue = issue
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ftsQuery turns free text into an FTS5 query that cannot trip over the
+// FTS5 syntax: each term is quoted and all terms must match.
+func ftsQuery(query string) (string, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return "", invalidField("query", "search query is required")
+	}
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimRight(term, "*")
+		if term == "" {
+			continue
+		}
+		quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			quoted += "*"
+		}
+		parts = append(parts, quoted)
+	}
+	if len(parts) == 0 {
+		return "", invalidField("query", "search query is required")
+	}
+	return strings.Join(parts, " "), nil
+}
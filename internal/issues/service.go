@@ -2,12 +2,10 @@ package issues
 
 import (
 	"context"
-	"crypto/rand"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/big"
 	"regexp"
 	"strings"
 	"time"
@@ -18,162 +16,220 @@ var issueIDRe = regexp.MustCompile(`^[a-z0-9]{3}-[0-9]+$`)
 
 const sqliteTimeLayout = "2006-01-02 15:04:05"
 
+// legacyIssueNumberFloor is the smallest number handed out by the old random
+// allocator; IDs at or above it are ignored when seeding project counters.
+const legacyIssueNumberFloor = 100000
+
+// issueNumberExpr extracts the numeric part of an issue ID in SQL, so that
+// cat-10 sorts after cat-9.
+const issueNumberExpr = "CAST(substr(id, 5) AS INTEGER)"
+
+const issueSelectColumns = "id, category, title, body, state, parent_id, version, " + issueBlockedByExpr + ", blocked_reason, created_at, last_updated_at, closed_at, archived_at, assignee, " + issueLabelsExpr + ", " + issueBlocksExpr
+
+// issueLabelsExpr collects an issue's labels as a sorted JSON array.
+const issueLabelsExpr = "(SELECT json_group_array(label) FROM (SELECT label FROM issue_labels WHERE issue_id = issues.id ORDER BY label))"
+
+// issueBlockedByExpr collects an issue's dependencies as a JSON array, in
+// the order they were set.
+const issueBlockedByExpr = "(SELECT json_group_array(depends_on_id) FROM (SELECT depends_on_id FROM issue_dependencies WHERE issue_id = issues.id ORDER BY position))"
+
+// issueBlocksExpr collects the issues that depend on an issue as a JSON
+// array, in ID order.
+const issueBlocksExpr = "(SELECT json_group_array(issue_id) FROM (SELECT issue_id FROM issue_dependencies WHERE depends_on_id = issues.id ORDER BY CAST(substr(issue_id, 5) AS INTEGER), issue_id))"
+
 type Service struct {
-	db *sql.DB
+	db    *sql.DB
+	actor string
 }
 
 func NewService(db *sql.DB) *Service {
 	return &Service{db: db}
 }
 
+// Actor reports the name recorded on history events written by this service.
+func (s *Service) Actor() string {
+	return s.actor
+}
+
+// WithActor returns a copy of the service that records actor on every
+// history event it writes.
+func (s *Service) WithActor(actor string) *Service {
+	clone := *s
+	clone.actor = strings.TrimSpace(actor)
+	return &clone
+}
+
 func (s *Service) CreateIssue(ctx context.Context, projectPrefix string, category Category, title, body string, parentID *string, blockedBy []string) (*Issue, error) {
 	projectPrefix = strings.TrimSpace(strings.ToLower(projectPrefix))
 	title = strings.TrimSpace(title)
 	if !projectPrefixRe.MatchString(projectPrefix) {
-		return nil, fmt.Errorf("%w: project prefix must be exactly 3 lowercase alphanumeric chars", ErrInvalidInput)
+		return nil, invalidField("project", "project prefix must be exactly 3 lowercase alphanumeric chars")
 	}
 	if !IsValidCategory(category) {
-		return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidInput, category)
+		return nil, invalidField("category", "unknown category %q", category)
 	}
 	if title == "" {
-		return nil, fmt.Errorf("%w: title is required", ErrInvalidInput)
+		return nil, invalidField("title", "title is required")
 	}
 
-	const maxCreateAttempts = 8
-	for attempt := 0; attempt < maxCreateAttempts; attempt++ {
-		tx, err := s.db.BeginTx(ctx, nil)
-		if err != nil {
-			return nil, err
-		}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
-		number, err := randomIssueNumber()
+	// Allocate the number first so the transaction takes the write lock
+	// before any reads.
+	number, err := nextIssueNumberTx(ctx, tx, projectPrefix)
+	if err != nil {
+		return nil, err
+	}
+	issueID := fmt.Sprintf("%s-%d", projectPrefix, number)
+
+	var cleanParent any
+	requiredParentCategory, needsParent := expectedParentCategory(category)
+	hasParent := parentID != nil && strings.TrimSpace(*parentID) != ""
+	if needsParent && !hasParent {
+		return nil, invalidField("parent_id", "category %q requires parent category %q", category, requiredParentCategory)
+	}
+	if !needsParent && hasParent {
+		return nil, invalidField("parent_id", "category %q cannot have a parent", category)
+	}
+	if hasParent {
+		pid := strings.TrimSpace(*parentID)
+		parent, err := getIssueByIDTx(ctx, tx, pid)
 		if err != nil {
-			_ = tx.Rollback()
+			if errors.Is(err, ErrNotFound) {
+				return nil, &Error{Kind: ErrNotFound, Message: fmt.Sprintf("parent issue %q not found", pid), Field: "parent_id", IDs: []string{pid}}
+			}
 			return nil, err
 		}
-		issueID := fmt.Sprintf("%s-%d", projectPrefix, number)
-
-		var cleanParent any
-		requiredParentCategory, needsParent := expectedParentCategory(category)
-		hasParent := parentID != nil && strings.TrimSpace(*parentID) != ""
-		if needsParent && !hasParent {
-			_ = tx.Rollback()
-			return nil, fmt.Errorf("%w: category %q requires parent category %q", ErrInvalidInput, category, requiredParentCategory)
-		}
-		if !needsParent && hasParent {
-			_ = tx.Rollback()
-			return nil, fmt.Errorf("%w: category %q cannot have a parent", ErrInvalidInput, category)
-		}
-		if hasParent {
-			pid := strings.TrimSpace(*parentID)
-			parent, err := getIssueByIDTx(ctx, tx, pid)
-			if err != nil {
-				_ = tx.Rollback()
-				if errors.Is(err, ErrNotFound) {
-					return nil, fmt.Errorf("%w: parent issue %q not found", ErrNotFound, pid)
-				}
-				return nil, err
-			}
-			if parent.ProjectPrefix != projectPrefix {
-				_ = tx.Rollback()
-				return nil, fmt.Errorf("%w: parent issue must be in same project", ErrInvalidInput)
-			}
-			if parent.Category != requiredParentCategory {
-				_ = tx.Rollback()
-				return nil, fmt.Errorf("%w: category %q requires parent category %q", ErrInvalidInput, category, requiredParentCategory)
-			}
-			cleanParent = pid
+		if parent.ProjectPrefix != projectPrefix {
+			return nil, invalidField("parent_id", "parent issue must be in same project")
 		}
-
-		normalizedBlockedBy, err := normalizeBlockedByTx(ctx, tx, issueID, projectPrefix, blockedBy)
-		if err != nil {
-			_ = tx.Rollback()
-			return nil, err
+		if parent.Category != requiredParentCategory {
+			return nil, invalidField("parent_id", "category %q requires parent category %q", category, requiredParentCategory)
 		}
-		blockedByJSON, err := json.Marshal(normalizedBlockedBy)
-		if err != nil {
-			_ = tx.Rollback()
-			return nil, fmt.Errorf("marshal blocked_by: %w", err)
+		if parent.ArchivedAt != nil {
+			return nil, archivedTargetError("parent_id", "parent", pid)
 		}
+		cleanParent = pid
+	}
 
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO issues(id, category, title, body, state, parent_id, version, blocked_by)
-			VALUES (?, ?, ?, ?, 'todo', ?, 1, ?)
-		`, issueID, string(category), title, body, cleanParent, string(blockedByJSON))
-		if err != nil {
-			if isUniqueViolation(err) {
-				_ = tx.Rollback()
-				continue
-			}
-			_ = tx.Rollback()
-			return nil, err
-		}
+	normalizedBlockedBy, err := normalizeBlockedByTx(ctx, tx, issueID, projectPrefix, blockedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBlockedByCycleTx(ctx, tx, issueID, normalizedBlockedBy); err != nil {
+		return nil, err
+	}
 
-		issue, err := getIssueByIDTx(ctx, tx, issueID)
-		if err != nil {
-			_ = tx.Rollback()
-			return nil, err
-		}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO issues(id, category, title, body, state, parent_id, version)
+		VALUES (?, ?, ?, ?, 'todo', ?, 1)
+	`, issueID, string(category), title, body, cleanParent)
+	if err != nil {
+		return nil, err
+	}
+	if err := setDependenciesTx(ctx, tx, issueID, normalizedBlockedBy); err != nil {
+		return nil, err
+	}
 
-		if err := tx.Commit(); err != nil {
-			if isUniqueViolation(err) {
-				continue
-			}
-			return nil, err
-		}
-		return issue, nil
+	issue, err := getIssueByIDTx(ctx, tx, issueID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordEventTx(ctx, tx, issue.ID, EventCreate, nil, stringPtr(string(issue.State)), issue.Version, s.actor); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("%w: failed to allocate issue number after retries", ErrConflict)
+	return issue, nil
 }
 
 func (s *Service) GetIssue(ctx context.Context, id string) (*Issue, error) {
 	return getIssueByIDDB(ctx, s.db, strings.TrimSpace(id))
 }
 
-func (s *Service) ListIssues(ctx context.Context, projectPrefix string, state *State) ([]Issue, error) {
-	conds := []string{"1=1"}
-	args := make([]any, 0, 2)
-	if p := strings.TrimSpace(projectPrefix); p != "" {
-		conds = append(conds, "id LIKE ?")
-		args = append(args, strings.ToLower(p)+"-%")
+// ListIssues returns the issues matching filter. When filter.Limit is set,
+// at most that many issues are returned, along with a cursor for the next
+// page; the cursor is empty on the last page.
+func (s *Service) ListIssues(ctx context.Context, filter ListFilter) ([]Issue, string, error) {
+	if filter.Limit < 0 {
+		return nil, "", invalidField("limit", "limit cannot be negative")
+	}
+	where, args, err := filter.whereClause(s.actor)
+	if err != nil {
+		return nil, "", err
+	}
+	sortKey, err := filter.sortKey()
+	if err != nil {
+		return nil, "", err
 	}
-	if state != nil {
-		if !IsValidState(*state) {
-			return nil, fmt.Errorf("%w: unknown state %q", ErrInvalidInput, *state)
+	if filter.Cursor != "" {
+		cond, cursorArgs, err := filter.cursorClause(sortKey)
+		if err != nil {
+			return nil, "", err
 		}
-		conds = append(conds, "state = ?")
-		args = append(args, string(*state))
+		where += " AND " + cond
+		args = append(args, cursorArgs...)
 	}
 	query := fmt.Sprintf(`
-		SELECT id, category, title, body, state, parent_id, version, blocked_by, created_at, last_updated_at, closed_at
+		SELECT %s, %s
 		FROM issues
 		WHERE %s
-		ORDER BY created_at ASC, id ASC
-	`, strings.Join(conds, " AND "))
+		ORDER BY %s
+	`, issueSelectColumns, sortKey, where, filter.orderByClause(sortKey))
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer rows.Close()
 
-	var out []Issue
+	out := make([]Issue, 0)
+	var keys []string
 	for rows.Next() {
-		issue, err := scanIssue(rows)
+		var key string
+		issue, err := scanIssue(extraScanner{row: rows, extra: []any{&key}})
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 		out = append(out, issue)
+		keys = append(keys, key)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return out, nil
+
+	if filter.Limit == 0 || len(out) <= filter.Limit {
+		return out, "", nil
+	}
+	out = out[:filter.Limit]
+	last := out[len(out)-1]
+	next, err := encodeCursor(filter, keys[filter.Limit-1], last.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return out, next, nil
 }
 
-func (s *Service) TransitionState(ctx context.Context, id string, to State, expectedVersion *int64) (*Issue, error) {
+func (s *Service) TransitionState(ctx context.Context, id string, to State, blockedReason string, expectedVersion *int64) (*Issue, error) {
 	if !IsValidState(to) {
-		return nil, fmt.Errorf("%w: unknown target state %q", ErrInvalidInput, to)
+		return nil, invalidField("state", "unknown target state %q", to)
+	}
+	blockedReason = strings.TrimSpace(blockedReason)
+	if to == StateBlocked && blockedReason == "" {
+		return nil, invalidField("blocked_reason", "blocked reason is required when moving to %s", StateBlocked)
+	}
+	if to != StateBlocked && blockedReason != "" {
+		return nil, invalidField("blocked_reason", "blocked reason only applies to state %s", StateBlocked)
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -196,7 +252,7 @@ func (s *Service) TransitionState(ctx context.Context, id string, to State, expe
 			return nil, err
 		}
 		if len(unresolved) > 0 {
-			return nil, fmt.Errorf("%w: blocked_by not done: %s", ErrInvalidInput, strings.Join(unresolved, ","))
+			return nil, &Error{Kind: ErrInvalidInput, Message: "blocked_by not done: " + strings.Join(unresolved, ","), Field: "blocked_by", IDs: unresolved}
 		}
 	}
 
@@ -207,6 +263,12 @@ func (s *Service) TransitionState(ctx context.Context, id string, to State, expe
 	} else {
 		setParts = append(setParts, "closed_at = NULL")
 	}
+	if to == StateBlocked {
+		setParts = append(setParts, "blocked_reason = ?")
+		params = append(params, blockedReason)
+	} else {
+		setParts = append(setParts, "blocked_reason = NULL")
+	}
 
 	query := fmt.Sprintf("UPDATE issues SET %s WHERE id = ?", strings.Join(setParts, ", "))
 	params = append(params, id)
@@ -222,15 +284,97 @@ func (s *Service) TransitionState(ctx context.Context, id string, to State, expe
 	affected, _ := res.RowsAffected()
 	if affected == 0 {
 		if expectedVersion != nil {
-			return nil, fmt.Errorf("%w: stale write; expected version %d", ErrConflict, *expectedVersion)
+			return nil, staleWriteError(id, *expectedVersion, issue.Version)
 		}
-		return nil, fmt.Errorf("%w: issue %q not found", ErrNotFound, id)
+		return nil, notFoundError(id)
 	}
 
 	updated, err := getIssueByIDTx(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
+	if err := recordEventTx(ctx, tx, id, EventState, stringPtr(string(issue.State)), stringPtr(string(updated.State)), updated.Version, s.actor); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// UpdateIssue changes the title and/or body of an issue. Nil fields are left
+// untouched.
+func (s *Service) UpdateIssue(ctx context.Context, id string, title, body *string, expectedVersion *int64) (*Issue, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, invalidField("id", "id is required")
+	}
+	if title == nil && body == nil {
+		return nil, fmt.Errorf("%w: nothing to update; provide a title or body", ErrInvalidInput)
+	}
+	var newTitle string
+	if title != nil {
+		newTitle = strings.TrimSpace(*title)
+		if newTitle == "" {
+			return nil, invalidField("title", "title cannot be empty")
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	issue, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	setParts := []string{"version = version + 1", "last_updated_at = CURRENT_TIMESTAMP"}
+	args := make([]any, 0, 4)
+	if title != nil {
+		setParts = append(setParts, "title = ?")
+		args = append(args, newTitle)
+	}
+	if body != nil {
+		setParts = append(setParts, "body = ?")
+		args = append(args, *body)
+	}
+
+	query := fmt.Sprintf("UPDATE issues SET %s WHERE id = ?", strings.Join(setParts, ", "))
+	args = append(args, id)
+	if expectedVersion != nil {
+		query += " AND version = ?"
+		args = append(args, *expectedVersion)
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		if expectedVersion != nil {
+			return nil, staleWriteError(id, *expectedVersion, issue.Version)
+		}
+		return nil, notFoundError(id)
+	}
+
+	updated, err := getIssueByIDTx(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if title != nil {
+		if err := recordEventTx(ctx, tx, id, EventTitle, stringPtr(issue.Title), stringPtr(updated.Title), updated.Version, s.actor); err != nil {
+			return nil, err
+		}
+	}
+	if body != nil {
+		if err := recordEventTx(ctx, tx, id, EventBody, stringPtr(issue.Body), stringPtr(updated.Body), updated.Version, s.actor); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
@@ -241,7 +385,7 @@ func (s *Service) TransitionState(ctx context.Context, id string, to State, expe
 func (s *Service) SetParent(ctx context.Context, id string, parentID *string, expectedVersion *int64) (*Issue, error) {
 	id = strings.TrimSpace(id)
 	if id == "" {
-		return nil, fmt.Errorf("%w: id is required", ErrInvalidInput)
+		return nil, invalidField("id", "id is required")
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -258,10 +402,10 @@ func (s *Service) SetParent(ctx context.Context, id string, parentID *string, ex
 	requiredParentCategory, needsParent := expectedParentCategory(issue.Category)
 	var newParent any
 	if needsParent && (parentID == nil || strings.TrimSpace(*parentID) == "") {
-		return nil, fmt.Errorf("%w: category %q requires parent category %q", ErrInvalidInput, issue.Category, requiredParentCategory)
+		return nil, invalidField("parent_id", "category %q requires parent category %q", issue.Category, requiredParentCategory)
 	}
 	if !needsParent && parentID != nil && strings.TrimSpace(*parentID) != "" {
-		return nil, fmt.Errorf("%w: category %q cannot have a parent", ErrInvalidInput, issue.Category)
+		return nil, invalidField("parent_id", "category %q cannot have a parent", issue.Category)
 	}
 
 	if needsParent {
@@ -271,10 +415,13 @@ func (s *Service) SetParent(ctx context.Context, id string, parentID *string, ex
 			return nil, err
 		}
 		if parent.ProjectPrefix != issue.ProjectPrefix {
-			return nil, fmt.Errorf("%w: parent must be in same project", ErrInvalidInput)
+			return nil, invalidField("parent_id", "parent must be in same project")
 		}
 		if parent.Category != requiredParentCategory {
-			return nil, fmt.Errorf("%w: category %q requires parent category %q", ErrInvalidInput, issue.Category, requiredParentCategory)
+			return nil, invalidField("parent_id", "category %q requires parent category %q", issue.Category, requiredParentCategory)
+		}
+		if parent.ArchivedAt != nil {
+			return nil, archivedTargetError("parent_id", "parent", pid)
 		}
 		newParent = pid
 	}
@@ -292,15 +439,18 @@ func (s *Service) SetParent(ctx context.Context, id string, parentID *string, ex
 	affected, _ := res.RowsAffected()
 	if affected == 0 {
 		if expectedVersion != nil {
-			return nil, fmt.Errorf("%w: stale write; expected version %d", ErrConflict, *expectedVersion)
+			return nil, staleWriteError(id, *expectedVersion, issue.Version)
 		}
-		return nil, fmt.Errorf("%w: issue %q not found", ErrNotFound, id)
+		return nil, notFoundError(id)
 	}
 
 	updated, err := getIssueByIDTx(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
+	if err := recordEventTx(ctx, tx, id, EventParent, issue.ParentID, updated.ParentID, updated.Version, s.actor); err != nil {
+		return nil, err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, err
@@ -311,7 +461,7 @@ func (s *Service) SetParent(ctx context.Context, id string, parentID *string, ex
 func (s *Service) SetBlockedBy(ctx context.Context, id string, blockedBy []string, expectedVersion *int64) (*Issue, error) {
 	id = strings.TrimSpace(id)
 	if id == "" {
-		return nil, fmt.Errorf("%w: id is required", ErrInvalidInput)
+		return nil, invalidField("id", "id is required")
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
@@ -328,13 +478,16 @@ func (s *Service) SetBlockedBy(ctx context.Context, id string, blockedBy []strin
 	if err != nil {
 		return nil, err
 	}
+	if err := checkBlockedByCycleTx(ctx, tx, issue.ID, normalized); err != nil {
+		return nil, err
+	}
 	blockedByJSON, err := json.Marshal(normalized)
 	if err != nil {
 		return nil, fmt.Errorf("marshal blocked_by: %w", err)
 	}
 
-	query := "UPDATE issues SET blocked_by = ?, version = version + 1, last_updated_at = CURRENT_TIMESTAMP WHERE id = ?"
-	args := []any{string(blockedByJSON), id}
+	query := "UPDATE issues SET version = version + 1, last_updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	args := []any{id}
 	if expectedVersion != nil {
 		query += " AND version = ?"
 		args = append(args, *expectedVersion)
@@ -346,23 +499,33 @@ func (s *Service) SetBlockedBy(ctx context.Context, id string, blockedBy []strin
 	affected, _ := res.RowsAffected()
 	if affected == 0 {
 		if expectedVersion != nil {
-			return nil, fmt.Errorf("%w: stale write; expected version %d", ErrConflict, *expectedVersion)
+			return nil, staleWriteError(id, *expectedVersion, issue.Version)
 		}
-		return nil, fmt.Errorf("%w: issue %q not found", ErrNotFound, id)
+		return nil, notFoundError(id)
+	}
+	if err := setDependenciesTx(ctx, tx, id, normalized); err != nil {
+		return nil, err
 	}
 
 	updated, err := getIssueByIDTx(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
+	oldValue, err := blockedByEventValue(issue.BlockedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordEventTx(ctx, tx, id, EventBlockedBy, oldValue, stringPtr(string(blockedByJSON)), updated.Version, s.actor); err != nil {
+		return nil, err
+	}
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 	return updated, nil
 }
 
-func (s *Service) Tree(ctx context.Context, projectPrefix string) ([]TreeNode, error) {
-	issuesList, err := s.ListIssues(ctx, projectPrefix, nil)
+func (s *Service) Tree(ctx context.Context, projectPrefix string, includeArchived bool) ([]TreeNode, error) {
+	issuesList, _, err := s.ListIssues(ctx, ListFilter{ProjectPrefix: projectPrefix, IncludeArchived: includeArchived})
 	if err != nil {
 		return nil, err
 	}
@@ -379,7 +542,7 @@ func (s *Service) Tree(ctx context.Context, projectPrefix string) ([]TreeNode, e
 
 	var build func(Issue) TreeNode
 	build = func(root Issue) TreeNode {
-		node := TreeNode{Issue: root}
+		node := TreeNode{Issue: root, Children: []TreeNode{}}
 		for _, ch := range children[root.ID] {
 			node.Children = append(node.Children, build(ch))
 		}
@@ -393,24 +556,49 @@ func (s *Service) Tree(ctx context.Context, projectPrefix string) ([]TreeNode, e
 	return out, nil
 }
 
-func randomIssueNumber() (int64, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+// nextIssueNumberTx bumps the per-project counter and returns the next free
+// issue number. The counter is seeded from existing sequential IDs, and
+// numbers already taken by legacy random IDs are skipped.
+func nextIssueNumberTx(ctx context.Context, tx *sql.Tx, projectPrefix string) (int64, error) {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO project_counters(project_prefix, last_number)
+		SELECT ?, COALESCE(MAX(`+issueNumberExpr+`), 0)
+		FROM issues
+		WHERE id LIKE ? AND `+issueNumberExpr+` < ?
+		ON CONFLICT(project_prefix) DO NOTHING
+	`, projectPrefix, projectPrefix+"-%", legacyIssueNumberFloor)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("seed issue counter: %w", err)
+	}
+
+	for {
+		var number int64
+		err := tx.QueryRowContext(ctx, `
+			UPDATE project_counters SET last_number = last_number + 1
+			WHERE project_prefix = ?
+			RETURNING last_number
+		`, projectPrefix).Scan(&number)
+		if err != nil {
+			return 0, fmt.Errorf("allocate issue number: %w", err)
+		}
+
+		var taken int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(1) FROM issues WHERE id = ?`, fmt.Sprintf("%s-%d", projectPrefix, number)).Scan(&taken)
+		if err != nil {
+			return 0, err
+		}
+		if taken == 0 {
+			return number, nil
+		}
 	}
-	return 100000 + n.Int64(), nil
 }
 
 func getIssueByIDDB(ctx context.Context, db *sql.DB, id string) (*Issue, error) {
-	row := db.QueryRowContext(ctx, `
-		SELECT id, category, title, body, state, parent_id, version, blocked_by, created_at, last_updated_at, closed_at
-		FROM issues
-		WHERE id = ?
-	`, id)
+	row := db.QueryRowContext(ctx, `SELECT `+issueSelectColumns+` FROM issues WHERE id = ?`, id)
 	issue, err := scanIssue(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("%w: issue %q not found", ErrNotFound, id)
+			return nil, notFoundError(id)
 		}
 		return nil, err
 	}
@@ -418,15 +606,11 @@ func getIssueByIDDB(ctx context.Context, db *sql.DB, id string) (*Issue, error)
 }
 
 func getIssueByIDTx(ctx context.Context, tx *sql.Tx, id string) (*Issue, error) {
-	row := tx.QueryRowContext(ctx, `
-		SELECT id, category, title, body, state, parent_id, version, blocked_by, created_at, last_updated_at, closed_at
-		FROM issues
-		WHERE id = ?
-	`, id)
+	row := tx.QueryRowContext(ctx, `SELECT `+issueSelectColumns+` FROM issues WHERE id = ?`, id)
 	issue, err := scanIssue(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("%w: issue %q not found", ErrNotFound, id)
+			return nil, notFoundError(id)
 		}
 		return nil, err
 	}
@@ -437,13 +621,29 @@ type scanner interface {
 	Scan(dest ...any) error
 }
 
+// extraScanner appends extra destinations after the issue columns, for
+// queries that select more than issueSelectColumns.
+type extraScanner struct {
+	row   scanner
+	extra []any
+}
+
+func (e extraScanner) Scan(dest ...any) error {
+	return e.row.Scan(append(dest, e.extra...)...)
+}
+
 func scanIssue(row scanner) (Issue, error) {
 	var is Issue
 	var parent sql.NullString
 	var blockedByRaw sql.NullString
+	var blockedReason sql.NullString
 	var created string
 	var lastUpdated string
 	var closed sql.NullString
+	var archived sql.NullString
+	var assignee sql.NullString
+	var labelsRaw sql.NullString
+	var blocksRaw sql.NullString
 	if err := row.Scan(
 		&is.ID,
 		&is.Category,
@@ -453,9 +653,14 @@ func scanIssue(row scanner) (Issue, error) {
 		&parent,
 		&is.Version,
 		&blockedByRaw,
+		&blockedReason,
 		&created,
 		&lastUpdated,
 		&closed,
+		&archived,
+		&assignee,
+		&labelsRaw,
+		&blocksRaw,
 	); err != nil {
 		return Issue{}, err
 	}
@@ -464,6 +669,14 @@ func scanIssue(row scanner) (Issue, error) {
 		p := parent.String
 		is.ParentID = &p
 	}
+	if assignee.Valid {
+		a := assignee.String
+		is.Assignee = &a
+	}
+	if blockedReason.Valid {
+		r := blockedReason.String
+		is.BlockedReason = &r
+	}
 	if blockedByRaw.Valid && strings.TrimSpace(blockedByRaw.String) != "" {
 		if err := json.Unmarshal([]byte(blockedByRaw.String), &is.BlockedBy); err != nil {
 			return Issue{}, fmt.Errorf("parse blocked_by for %s: %w", is.ID, err)
@@ -472,6 +685,20 @@ func scanIssue(row scanner) (Issue, error) {
 		is.BlockedBy = []string{}
 	}
 
+	is.Blocks = []string{}
+	if blocksRaw.Valid && strings.TrimSpace(blocksRaw.String) != "" {
+		if err := json.Unmarshal([]byte(blocksRaw.String), &is.Blocks); err != nil {
+			return Issue{}, fmt.Errorf("parse blocks for %s: %w", is.ID, err)
+		}
+	}
+
+	is.Labels = []string{}
+	if labelsRaw.Valid && strings.TrimSpace(labelsRaw.String) != "" {
+		if err := json.Unmarshal([]byte(labelsRaw.String), &is.Labels); err != nil {
+			return Issue{}, fmt.Errorf("parse labels for %s: %w", is.ID, err)
+		}
+	}
+
 	if prefix, ok := projectPrefixFromIssueID(is.ID); ok {
 		is.ProjectPrefix = prefix
 	}
@@ -494,6 +721,13 @@ func scanIssue(row scanner) (Issue, error) {
 		}
 		is.ClosedAt = &closedAt
 	}
+	if archived.Valid {
+		archivedAt, err := parseSQLiteTime(archived.String)
+		if err != nil {
+			return Issue{}, err
+		}
+		is.ArchivedAt = &archivedAt
+	}
 
 	return is, nil
 }
@@ -506,10 +740,6 @@ func parseSQLiteTime(value string) (time.Time, error) {
 	return time.Parse(time.RFC3339Nano, value)
 }
 
-func isUniqueViolation(err error) bool {
-	return strings.Contains(strings.ToLower(err.Error()), "unique")
-}
-
 func projectPrefixFromIssueID(id string) (string, bool) {
 	parts := strings.SplitN(strings.ToLower(strings.TrimSpace(id)), "-", 2)
 	if len(parts) != 2 {
@@ -530,10 +760,10 @@ func normalizeBlockedByTx(ctx context.Context, tx *sql.Tx, issueID, projectPrefi
 			continue
 		}
 		if !issueIDRe.MatchString(id) {
-			return nil, fmt.Errorf("%w: invalid blocked_by issue id %q", ErrInvalidInput, id)
+			return nil, invalidField("blocked_by", "invalid blocked_by issue id %q", id)
 		}
 		if id == issueID {
-			return nil, fmt.Errorf("%w: blocked_by cannot include self", ErrInvalidInput)
+			return nil, invalidField("blocked_by", "blocked_by cannot include self")
 		}
 		if seen[id] {
 			continue
@@ -542,36 +772,52 @@ func normalizeBlockedByTx(ctx context.Context, tx *sql.Tx, issueID, projectPrefi
 
 		prefix, ok := projectPrefixFromIssueID(id)
 		if !ok || prefix != projectPrefix {
-			return nil, fmt.Errorf("%w: blocked_by issue must be in same project: %q", ErrInvalidInput, id)
+			return nil, invalidField("blocked_by", "blocked_by issue must be in same project: %q", id)
 		}
 		dep, err := getIssueByIDTx(ctx, tx, id)
 		if err != nil {
 			if errors.Is(err, ErrNotFound) {
-				return nil, fmt.Errorf("%w: blocked_by issue %q not found", ErrNotFound, id)
+				return nil, &Error{Kind: ErrNotFound, Message: fmt.Sprintf("blocked_by issue %q not found", id), Field: "blocked_by", IDs: []string{id}}
 			}
 			return nil, err
 		}
 		if dep.ProjectPrefix != projectPrefix {
-			return nil, fmt.Errorf("%w: blocked_by issue must be in same project: %q", ErrInvalidInput, id)
+			return nil, invalidField("blocked_by", "blocked_by issue must be in same project: %q", id)
+		}
+		if dep.ArchivedAt != nil {
+			return nil, archivedTargetError("blocked_by", "blocked_by", id)
 		}
 		out = append(out, id)
 	}
 	return out, nil
 }
 
+// archivedTargetError rejects an archived issue as a parent or dependency.
+// Archived issues are hidden from list and tree, so a new child would be
+// hidden with them and a new dependency could never be seen to finish.
+func archivedTargetError(field, role, id string) error {
+	return &Error{Kind: ErrInvalidInput, Message: fmt.Sprintf("%s issue %q is archived", role, id), Field: field, IDs: []string{id}}
+}
+
 func unresolvedBlockedByTx(ctx context.Context, tx *sql.Tx, issue *Issue) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.depends_on_id
+		FROM issue_dependencies d
+		JOIN issues dep ON dep.id = d.depends_on_id
+		WHERE d.issue_id = ? AND `+unresolvedDepCond+`
+		ORDER BY d.position
+	`, issue.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	unresolved := make([]string, 0)
-	for _, depID := range issue.BlockedBy {
-		dep, err := getIssueByIDTx(ctx, tx, depID)
-		if err != nil {
-			if errors.Is(err, ErrNotFound) {
-				return nil, fmt.Errorf("%w: blocked_by issue %q not found", ErrNotFound, depID)
-			}
+	for rows.Next() {
+		var depID string
+		if err := rows.Scan(&depID); err != nil {
 			return nil, err
 		}
-		if dep.State != StateDone {
-			unresolved = append(unresolved, dep.ID)
-		}
+		unresolved = append(unresolved, depID)
 	}
-	return unresolved, nil
+	return unresolved, rows.Err()
 }
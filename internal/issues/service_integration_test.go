@@ -3,8 +3,11 @@ package issues_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/satyaki-up/issuetracker/internal/db"
 	"github.com/satyaki-up/issuetracker/internal/issues"
@@ -59,7 +62,7 @@ func TestHierarchyIntegration(t *testing.T) {
 		t.Fatalf("expected invalid input error, got %v", err)
 	}
 
-	tree, err := svc.Tree(ctx, "cat")
+	tree, err := svc.Tree(ctx, "cat", false)
 	if err != nil {
 		t.Fatalf("tree: %v", err)
 	}
@@ -69,6 +72,9 @@ func TestHierarchyIntegration(t *testing.T) {
 	if len(tree[0].Children) != 1 || len(tree[0].Children[0].Children) != 1 {
 		t.Fatalf("expected project->workstream->task structure, got %+v", tree)
 	}
+	if leaf := tree[0].Children[0].Children[0]; leaf.Children == nil {
+		t.Fatalf("expected leaf children to be an empty slice so JSON renders [], got nil")
+	}
 }
 
 func TestLifecycleWithParentsAndStatesIntegration(t *testing.T) {
@@ -102,16 +108,16 @@ func TestLifecycleWithParentsAndStatesIntegration(t *testing.T) {
 		t.Fatalf("create task auth: %v", err)
 	}
 
-	if _, err := svc.TransitionState(ctx, taskAPI.ID, issues.StateInProgress, nil); err != nil {
+	if _, err := svc.TransitionState(ctx, taskAPI.ID, issues.StateInProgress, "", nil); err != nil {
 		t.Fatalf("taskAPI in_progress: %v", err)
 	}
-	if _, err := svc.TransitionState(ctx, taskAPI.ID, issues.StateDone, nil); err != nil {
+	if _, err := svc.TransitionState(ctx, taskAPI.ID, issues.StateDone, "", nil); err != nil {
 		t.Fatalf("taskAPI done: %v", err)
 	}
-	if _, err := svc.TransitionState(ctx, taskUI.ID, issues.StateBlocked, nil); err != nil {
+	if _, err := svc.TransitionState(ctx, taskUI.ID, issues.StateBlocked, "Waiting on design", nil); err != nil {
 		t.Fatalf("taskUI blocked: %v", err)
 	}
-	if _, err := svc.TransitionState(ctx, taskAuth.ID, issues.StateInProgress, nil); err != nil {
+	if _, err := svc.TransitionState(ctx, taskAuth.ID, issues.StateInProgress, "", nil); err != nil {
 		t.Fatalf("taskAuth in_progress: %v", err)
 	}
 
@@ -133,7 +139,7 @@ func TestLifecycleWithParentsAndStatesIntegration(t *testing.T) {
 		t.Fatalf("expected invalid input on parent removal, got %v", err)
 	}
 
-	allIssues, err := svc.ListIssues(ctx, "cat", nil)
+	allIssues, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat"})
 	if err != nil {
 		t.Fatalf("list issues: %v", err)
 	}
@@ -141,7 +147,7 @@ func TestLifecycleWithParentsAndStatesIntegration(t *testing.T) {
 		t.Fatalf("expected 6 issues total, got %d", len(allIssues))
 	}
 
-	tree, err := svc.Tree(ctx, "cat")
+	tree, err := svc.Tree(ctx, "cat", false)
 	if err != nil {
 		t.Fatalf("tree: %v", err)
 	}
@@ -163,7 +169,7 @@ func TestOptimisticConcurrencyIntegration(t *testing.T) {
 	}
 
 	expected := project.Version
-	updated, err := svc.TransitionState(ctx, project.ID, issues.StateInProgress, &expected)
+	updated, err := svc.TransitionState(ctx, project.ID, issues.StateInProgress, "", &expected)
 	if err != nil {
 		t.Fatalf("first transition: %v", err)
 	}
@@ -171,7 +177,7 @@ func TestOptimisticConcurrencyIntegration(t *testing.T) {
 		t.Fatalf("expected version to increase, old=%d new=%d", expected, updated.Version)
 	}
 
-	_, err = svc.TransitionState(ctx, project.ID, issues.StateBlocked, &expected)
+	_, err = svc.TransitionState(ctx, project.ID, issues.StateBlocked, "Waiting on design", &expected)
 	if err == nil {
 		t.Fatal("expected conflict on stale expected version")
 	}
@@ -201,18 +207,40 @@ func TestBlockedByDependenciesIntegration(t *testing.T) {
 		t.Fatalf("create target: %v", err)
 	}
 
-	if _, err := svc.TransitionState(ctx, target.ID, issues.StateInProgress, nil); err == nil {
+	if _, err := svc.TransitionState(ctx, target.ID, issues.StateInProgress, "", nil); err == nil {
 		t.Fatal("expected in_progress to fail while dependency is not done")
 	}
+	blocker, err := svc.GetIssue(ctx, dep.ID)
+	if err != nil {
+		t.Fatalf("get dep: %v", err)
+	}
+	if strings.Join(blocker.Blocks, ",") != target.ID || len(target.Blocks) != 0 {
+		t.Fatalf("expected %s to block %s only, got %v and %v", dep.ID, target.ID, blocker.Blocks, target.Blocks)
+	}
+	unresolved, err := svc.UnresolvedDependencies(ctx, []string{target.ID, dep.ID})
+	if err != nil {
+		t.Fatalf("unresolved dependencies: %v", err)
+	}
+	if len(unresolved) != 1 || len(unresolved[target.ID]) != 1 || unresolved[target.ID][0] != dep.ID {
+		t.Fatalf("unexpected unresolved dependencies: %+v", unresolved)
+	}
 
-	if _, err := svc.TransitionState(ctx, dep.ID, issues.StateInProgress, nil); err != nil {
+	if _, err := svc.TransitionState(ctx, dep.ID, issues.StateInProgress, "", nil); err != nil {
 		t.Fatalf("dep in_progress: %v", err)
 	}
-	if _, err := svc.TransitionState(ctx, dep.ID, issues.StateDone, nil); err != nil {
+	if _, err := svc.TransitionState(ctx, dep.ID, issues.StateDone, "", nil); err != nil {
 		t.Fatalf("dep done: %v", err)
 	}
 
-	if _, err := svc.TransitionState(ctx, target.ID, issues.StateInProgress, nil); err != nil {
+	unresolved, err = svc.UnresolvedDependencies(ctx, []string{target.ID})
+	if err != nil {
+		t.Fatalf("unresolved dependencies after dep done: %v", err)
+	}
+	if len(unresolved) != 0 {
+		t.Fatalf("expected no unresolved dependencies, got %+v", unresolved)
+	}
+
+	if _, err := svc.TransitionState(ctx, target.ID, issues.StateInProgress, "", nil); err != nil {
 		t.Fatalf("target in_progress after dep done: %v", err)
 	}
 
@@ -223,4 +251,1075 @@ func TestBlockedByDependenciesIntegration(t *testing.T) {
 	if len(updated.BlockedBy) != 0 {
 		t.Fatalf("expected empty blocked_by, got %+v", updated.BlockedBy)
 	}
+	if blocker, err = svc.GetIssue(ctx, dep.ID); err != nil || len(blocker.Blocks) != 0 {
+		t.Fatalf("expected no reverse dependencies after clearing, got %+v, %v", blocker, err)
+	}
+}
+
+func TestBlockedByCycleDetectionIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	a, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "A", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create a: %v", err)
+	}
+	b, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "B", "", &ws.ID, []string{a.ID})
+	if err != nil {
+		t.Fatalf("create b: %v", err)
+	}
+	c, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "C", "", &ws.ID, []string{b.ID})
+	if err != nil {
+		t.Fatalf("create c: %v", err)
+	}
+
+	_, err = svc.SetBlockedBy(ctx, a.ID, []string{c.ID}, nil)
+	if err == nil {
+		t.Fatal("expected cycle to be rejected")
+	}
+	if !errors.Is(err, issues.ErrCycleDetected) {
+		t.Fatalf("expected cycle detected error, got %v", err)
+	}
+	wantPath := a.ID + " -> " + c.ID + " -> " + b.ID + " -> " + a.ID
+	if !strings.Contains(err.Error(), wantPath) {
+		t.Fatalf("expected cycle path %q in error, got %v", wantPath, err)
+	}
+
+	unchanged, err := svc.GetIssue(ctx, a.ID)
+	if err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+	if len(unchanged.BlockedBy) != 0 {
+		t.Fatalf("expected blocked_by of a to stay empty, got %+v", unchanged.BlockedBy)
+	}
+
+	if _, err := svc.SetBlockedBy(ctx, c.ID, []string{a.ID, b.ID}, nil); err != nil {
+		t.Fatalf("non-cyclic diamond should be accepted: %v", err)
+	}
+}
+
+func TestBlockedReasonIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	project, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create issue: %v", err)
+	}
+
+	_, err = svc.TransitionState(ctx, project.ID, issues.StateBlocked, "  ", nil)
+	if !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input without blocked reason, got %v", err)
+	}
+	_, err = svc.TransitionState(ctx, project.ID, issues.StateInProgress, "not blocked", nil)
+	if !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for reason on non-blocked state, got %v", err)
+	}
+
+	blocked, err := svc.TransitionState(ctx, project.ID, issues.StateBlocked, "Waiting on API schema", nil)
+	if err != nil {
+		t.Fatalf("transition to blocked: %v", err)
+	}
+	if blocked.BlockedReason == nil || *blocked.BlockedReason != "Waiting on API schema" {
+		t.Fatalf("expected stored blocked reason, got %+v", blocked.BlockedReason)
+	}
+
+	resumed, err := svc.TransitionState(ctx, project.ID, issues.StateInProgress, "", nil)
+	if err != nil {
+		t.Fatalf("transition out of blocked: %v", err)
+	}
+	if resumed.BlockedReason != nil {
+		t.Fatalf("expected blocked reason to be cleared, got %q", *resumed.BlockedReason)
+	}
+}
+
+func TestHistoryIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t).WithActor("agent-a")
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	dep, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Foundation", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create dep: %v", err)
+	}
+	task, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Feature", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	if _, err := svc.TransitionState(ctx, task.ID, issues.StateInProgress, "", nil); err != nil {
+		t.Fatalf("task in_progress: %v", err)
+	}
+	if _, err := svc.SetBlockedBy(ctx, task.ID, []string{dep.ID}, nil); err != nil {
+		t.Fatalf("set blocked_by: %v", err)
+	}
+
+	events, err := svc.History(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	wantKinds := []issues.EventKind{issues.EventCreate, issues.EventState, issues.EventBlockedBy}
+	for i, ev := range events {
+		if ev.Kind != wantKinds[i] {
+			t.Fatalf("event %d: expected kind %s, got %s", i, wantKinds[i], ev.Kind)
+		}
+		if ev.Actor != "agent-a" {
+			t.Fatalf("event %d: expected actor agent-a, got %q", i, ev.Actor)
+		}
+		if ev.Version != int64(i+1) {
+			t.Fatalf("event %d: expected version %d, got %d", i, i+1, ev.Version)
+		}
+	}
+	if events[1].OldValue == nil || *events[1].OldValue != "todo" || events[1].NewValue == nil || *events[1].NewValue != "in_progress" {
+		t.Fatalf("unexpected state event values: %+v", events[1])
+	}
+	if events[2].NewValue == nil || *events[2].NewValue != `["`+dep.ID+`"]` {
+		t.Fatalf("unexpected blocked_by event value: %+v", events[2])
+	}
+
+	if _, err := svc.History(ctx, "cat-999999999"); !errors.Is(err, issues.ErrNotFound) {
+		t.Fatalf("expected not found for unknown issue, got %v", err)
+	}
+}
+
+func TestUpdateIssueIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	project, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "initial", nil, nil)
+	if err != nil {
+		t.Fatalf("create issue: %v", err)
+	}
+
+	newTitle := "Catalog Platform"
+	updated, err := svc.UpdateIssue(ctx, project.ID, &newTitle, nil, &project.Version)
+	if err != nil {
+		t.Fatalf("update title: %v", err)
+	}
+	if updated.Title != newTitle || updated.Body != "initial" {
+		t.Fatalf("expected only title to change, got %+v", updated)
+	}
+	if updated.Version != project.Version+1 {
+		t.Fatalf("expected version %d, got %d", project.Version+1, updated.Version)
+	}
+
+	newBody := "rewritten"
+	if _, err := svc.UpdateIssue(ctx, project.ID, nil, &newBody, &project.Version); !errors.Is(err, issues.ErrConflict) {
+		t.Fatalf("expected conflict on stale expected version, got %v", err)
+	}
+
+	empty := "  "
+	if _, err := svc.UpdateIssue(ctx, project.ID, &empty, nil, nil); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for empty title, got %v", err)
+	}
+	if _, err := svc.UpdateIssue(ctx, project.ID, nil, nil, nil); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input with nothing to update, got %v", err)
+	}
+
+	events, err := svc.History(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	if len(events) != 2 || events[1].Kind != issues.EventTitle {
+		t.Fatalf("expected create and title events, got %+v", events)
+	}
+}
+
+func TestSequentialIssueNumbersIntegration(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.Open(ctx, filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+
+	// Simulate rows left behind by the old random allocator.
+	if _, err := database.ExecContext(ctx, `
+		INSERT INTO issues(id, category, title, state) VALUES
+			('cat-3', 'project', 'Legacy small', 'todo'),
+			('cat-482913', 'project', 'Legacy random', 'todo')
+	`); err != nil {
+		t.Fatalf("insert legacy issues: %v", err)
+	}
+	svc := issues.NewService(database)
+
+	first, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "First", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create first: %v", err)
+	}
+	second, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Second", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create second: %v", err)
+	}
+	other, err := svc.CreateIssue(ctx, "dog", issues.CategoryProject, "Other", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create other project: %v", err)
+	}
+
+	if first.ID != "cat-4" || second.ID != "cat-5" {
+		t.Fatalf("expected cat-4 and cat-5, got %s and %s", first.ID, second.ID)
+	}
+	if other.ID != "dog-1" {
+		t.Fatalf("expected dog-1, got %s", other.ID)
+	}
+	if _, err := svc.GetIssue(ctx, "cat-482913"); err != nil {
+		t.Fatalf("legacy random id should be untouched: %v", err)
+	}
+}
+
+func TestDeleteAndArchiveIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	dep, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Foundation", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create dep: %v", err)
+	}
+	otherWS, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Frontend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create other workstream: %v", err)
+	}
+	dependent, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Feature", "", &otherWS.ID, []string{dep.ID})
+	if err != nil {
+		t.Fatalf("create dependent: %v", err)
+	}
+
+	if _, err := svc.DeleteIssue(ctx, ws.ID, false, nil); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected delete with children to be refused, got %v", err)
+	}
+	deleted, err := svc.DeleteIssue(ctx, ws.ID, true, nil)
+	if err != nil {
+		t.Fatalf("cascade delete: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Fatalf("expected workstream and task deleted, got %+v", deleted)
+	}
+	if _, err := svc.GetIssue(ctx, dep.ID); !errors.Is(err, issues.ErrNotFound) {
+		t.Fatalf("expected deleted task to be gone, got %v", err)
+	}
+	events, err := svc.History(ctx, dep.ID)
+	if err != nil || len(events) == 0 || events[len(events)-1].Kind != issues.EventDelete {
+		t.Fatalf("expected deleted task history to end in a delete event, got %+v, %v", events, err)
+	}
+	scrubbed, err := svc.GetIssue(ctx, dependent.ID)
+	if err != nil {
+		t.Fatalf("get dependent: %v", err)
+	}
+	if len(scrubbed.BlockedBy) != 0 {
+		t.Fatalf("expected deleted id scrubbed from blocked_by, got %+v", scrubbed.BlockedBy)
+	}
+	if _, err := svc.TransitionState(ctx, dependent.ID, issues.StateInProgress, "", nil); err != nil {
+		t.Fatalf("dependent should be startable after scrub: %v", err)
+	}
+
+	laterWS, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Later", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create later workstream: %v", err)
+	}
+	waiting, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Waiting", "", &laterWS.ID, []string{dependent.ID})
+	if err != nil {
+		t.Fatalf("create waiting: %v", err)
+	}
+
+	if _, err := svc.ArchiveIssue(ctx, otherWS.ID, false, nil); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected archive with children to be refused, got %v", err)
+	}
+	archived, err := svc.ArchiveIssue(ctx, otherWS.ID, true, nil)
+	if err != nil {
+		t.Fatalf("cascade archive: %v", err)
+	}
+	if archived.ArchivedAt == nil {
+		t.Fatal("expected archived_at to be set")
+	}
+	var fieldErr *issues.Error
+	if _, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Orphan", "", &otherWS.ID, nil); !errors.As(err, &fieldErr) || fieldErr.Field != "parent_id" {
+		t.Fatalf("expected an archived parent to be rejected, got %v", err)
+	}
+	if _, err := svc.SetParent(ctx, waiting.ID, &otherWS.ID, nil); !errors.As(err, &fieldErr) || fieldErr.Field != "parent_id" {
+		t.Fatalf("expected moving under an archived parent to be rejected, got %v", err)
+	}
+	if _, err := svc.SetBlockedBy(ctx, waiting.ID, []string{dependent.ID}, nil); !errors.As(err, &fieldErr) || fieldErr.Field != "blocked_by" || !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected an archived dependency to be rejected, got %v", err)
+	}
+	unblocked, err := svc.GetIssue(ctx, waiting.ID)
+	if err != nil || len(unblocked.BlockedBy) != 0 {
+		t.Fatalf("expected archived id scrubbed from blocked_by, got %+v, %v", unblocked, err)
+	}
+	events, err = svc.History(ctx, waiting.ID)
+	if err != nil || events[len(events)-1].Kind != issues.EventBlockedBy {
+		t.Fatalf("expected the scrub recorded as a blocked_by event, got %+v, %v", events, err)
+	}
+	ready, err := svc.ReadyIssues(ctx, "cat", 0)
+	if err != nil || len(ready) != 1 || ready[0].ID != waiting.ID {
+		t.Fatalf("expected a dependent of an archived issue to be ready, got %+v, %v", ready, err)
+	}
+	if _, err := svc.TransitionState(ctx, waiting.ID, issues.StateInProgress, "", nil); err != nil {
+		t.Fatalf("dependent of an archived issue should be startable: %v", err)
+	}
+
+	visible, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(visible) != 3 || visible[0].ID != root.ID {
+		t.Fatalf("expected the project and the later workstream to be visible, got %+v", visible)
+	}
+	all, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat", IncludeArchived: true})
+	if err != nil {
+		t.Fatalf("list including archived: %v", err)
+	}
+	if len(all) != 5 {
+		t.Fatalf("expected 5 issues including archived, got %d", len(all))
+	}
+}
+
+func TestCommentsIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	project, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create issue: %v", err)
+	}
+
+	if _, err := svc.WithActor("agent-a").AddComment(ctx, project.ID, "first note"); err != nil {
+		t.Fatalf("add first comment: %v", err)
+	}
+	if _, err := svc.WithActor("agent-b").AddComment(ctx, project.ID, "second note"); err != nil {
+		t.Fatalf("add second comment: %v", err)
+	}
+	if _, err := svc.AddComment(ctx, project.ID, "   "); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for empty comment, got %v", err)
+	}
+	if _, err := svc.AddComment(ctx, "cat-999999999", "orphan"); !errors.Is(err, issues.ErrNotFound) {
+		t.Fatalf("expected not found for unknown issue, got %v", err)
+	}
+
+	comments, err := svc.ListComments(ctx, project.ID)
+	if err != nil {
+		t.Fatalf("list comments: %v", err)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("expected 2 comments, got %d", len(comments))
+	}
+	if comments[0].Body != "first note" || comments[0].Author != "agent-a" || comments[1].Author != "agent-b" {
+		t.Fatalf("unexpected comments: %+v", comments)
+	}
+}
+
+func TestAssignAndClaimIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	task, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Build API", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	assigned, err := svc.AssignIssue(ctx, ws.ID, "agent-a", &ws.Version)
+	if err != nil {
+		t.Fatalf("assign workstream: %v", err)
+	}
+	if assigned.Assignee == nil || *assigned.Assignee != "agent-a" {
+		t.Fatalf("expected assignee agent-a, got %+v", assigned.Assignee)
+	}
+	if _, err := svc.AssignIssue(ctx, ws.ID, "agent-b", &ws.Version); !errors.Is(err, issues.ErrConflict) {
+		t.Fatalf("expected conflict on stale assign, got %v", err)
+	}
+
+	claimed, err := svc.ClaimIssue(ctx, task.ID, "agent-b")
+	if err != nil {
+		t.Fatalf("claim task: %v", err)
+	}
+	if claimed.State != issues.StateInProgress || claimed.Assignee == nil || *claimed.Assignee != "agent-b" {
+		t.Fatalf("expected in_progress task owned by agent-b, got %+v", claimed)
+	}
+	if _, err := svc.ClaimIssue(ctx, task.ID, "agent-c"); !errors.Is(err, issues.ErrConflict) {
+		t.Fatalf("expected conflict when claiming an owned issue, got %v", err)
+	}
+
+	mine, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat", Assignee: "agent-b"})
+	if err != nil {
+		t.Fatalf("list by assignee: %v", err)
+	}
+	if len(mine) != 1 || mine[0].ID != task.ID {
+		t.Fatalf("expected only the claimed task, got %+v", mine)
+	}
+
+	cleared, err := svc.AssignIssue(ctx, ws.ID, "", nil)
+	if err != nil {
+		t.Fatalf("unassign: %v", err)
+	}
+	if cleared.Assignee != nil {
+		t.Fatalf("expected assignee cleared, got %q", *cleared.Assignee)
+	}
+}
+
+func TestReadyIssuesIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	dep, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Foundation", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create dep: %v", err)
+	}
+	blocked, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Feature", "", &ws.ID, []string{dep.ID})
+	if err != nil {
+		t.Fatalf("create blocked task: %v", err)
+	}
+	free, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Docs", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create free task: %v", err)
+	}
+
+	ready, err := svc.ReadyIssues(ctx, "cat", 0)
+	if err != nil {
+		t.Fatalf("ready: %v", err)
+	}
+	if len(ready) != 2 || ready[0].ID != dep.ID || ready[1].ID != free.ID {
+		t.Fatalf("expected dep and free task in creation order, got %+v", ready)
+	}
+
+	if _, err := svc.ClaimIssue(ctx, dep.ID, "agent-a"); err != nil {
+		t.Fatalf("claim dep: %v", err)
+	}
+	if _, err := svc.TransitionState(ctx, dep.ID, issues.StateDone, "", nil); err != nil {
+		t.Fatalf("dep done: %v", err)
+	}
+
+	ready, err = svc.ReadyIssues(ctx, "cat", 1)
+	if err != nil {
+		t.Fatalf("ready with limit: %v", err)
+	}
+	if len(ready) != 1 || ready[0].ID != blocked.ID {
+		t.Fatalf("expected unblocked feature first, got %+v", ready)
+	}
+
+	if _, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Release", "", &ws.ID, []string{free.ID}); err != nil {
+		t.Fatalf("create release: %v", err)
+	}
+	ready, err = svc.ReadyIssues(ctx, "cat", 0)
+	if err != nil {
+		t.Fatalf("ready: %v", err)
+	}
+	if len(ready) != 2 || ready[0].ID != free.ID || ready[1].ID != blocked.ID {
+		t.Fatalf("expected the task blocking release before the older feature, got %+v", ready)
+	}
+}
+
+func TestLabelsIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	first, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create first: %v", err)
+	}
+	second, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Tooling", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create second: %v", err)
+	}
+	if len(first.Labels) != 0 {
+		t.Fatalf("expected no labels on new issue, got %+v", first.Labels)
+	}
+
+	labeled, err := svc.AddLabels(ctx, first.ID, []string{"Backend", "bug", "bug"})
+	if err != nil {
+		t.Fatalf("add labels: %v", err)
+	}
+	if strings.Join(labeled.Labels, ",") != "backend,bug" {
+		t.Fatalf("expected normalized sorted labels, got %+v", labeled.Labels)
+	}
+	if _, err := svc.AddLabels(ctx, second.ID, []string{"bug"}); err != nil {
+		t.Fatalf("add label to second: %v", err)
+	}
+	if _, err := svc.AddLabels(ctx, second.ID, []string{"no spaces"}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for bad label, got %v", err)
+	}
+
+	anyMatch, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat", AnyLabels: []string{"backend", "bug"}})
+	if err != nil {
+		t.Fatalf("list any labels: %v", err)
+	}
+	if len(anyMatch) != 2 {
+		t.Fatalf("expected both issues for any-label filter, got %d", len(anyMatch))
+	}
+	allMatch, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat", AllLabels: []string{"backend", "bug"}})
+	if err != nil {
+		t.Fatalf("list all labels: %v", err)
+	}
+	if len(allMatch) != 1 || allMatch[0].ID != first.ID {
+		t.Fatalf("expected only first issue for all-labels filter, got %+v", allMatch)
+	}
+
+	removed, err := svc.RemoveLabels(ctx, first.ID, []string{"backend"})
+	if err != nil {
+		t.Fatalf("remove label: %v", err)
+	}
+	if strings.Join(removed.Labels, ",") != "bug" {
+		t.Fatalf("expected only bug label left, got %+v", removed.Labels)
+	}
+}
+
+func TestListFilterAndSortIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	alpha, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Alpha", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create alpha: %v", err)
+	}
+	beta, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Beta", "", &ws.ID, []string{alpha.ID})
+	if err != nil {
+		t.Fatalf("create beta: %v", err)
+	}
+	if _, err := svc.TransitionState(ctx, alpha.ID, issues.StateInProgress, "", nil); err != nil {
+		t.Fatalf("alpha in_progress: %v", err)
+	}
+
+	ids := func(list []issues.Issue) string {
+		out := make([]string, 0, len(list))
+		for _, is := range list {
+			out = append(out, is.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	cases := []struct {
+		name   string
+		filter issues.ListFilter
+		want   string
+	}{
+		{"multiple states", issues.ListFilter{States: []issues.State{issues.StateTodo, issues.StateInProgress}, Categories: []issues.Category{issues.CategoryTask}}, alpha.ID + "," + beta.ID},
+		{"category", issues.ListFilter{Categories: []issues.Category{issues.CategoryWorkstream}}, ws.ID},
+		{"direct parent", issues.ListFilter{ParentID: root.ID}, ws.ID},
+		{"any ancestor", issues.ListFilter{AncestorID: root.ID}, ws.ID + "," + alpha.ID + "," + beta.ID},
+		{"unresolved deps", issues.ListFilter{HasUnresolvedDeps: boolPtr(true)}, beta.ID},
+		{"sort title reversed", issues.ListFilter{AncestorID: ws.ID, Sort: issues.SortTitle, Reverse: true}, beta.ID + "," + alpha.ID},
+		{"created in future", issues.ListFilter{CreatedAfter: timePtr(time.Now().Add(time.Hour))}, ""},
+	}
+	for _, tc := range cases {
+		got, _, err := svc.ListIssues(ctx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: list: %v", tc.name, err)
+		}
+		if ids(got) != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, ids(got))
+		}
+	}
+
+	if _, _, err := svc.ListIssues(ctx, issues.ListFilter{Sort: "priority"}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for unknown sort, got %v", err)
+	}
+}
+
+func boolPtr(v bool) *bool { return &v }
+
+func timePtr(v time.Time) *time.Time { return &v }
+
+func TestListPaginationIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	var created []string
+	for i := 0; i < 12; i++ {
+		is, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, fmt.Sprintf("Project %02d", i), "", nil, nil)
+		if err != nil {
+			t.Fatalf("create issue %d: %v", i, err)
+		}
+		created = append(created, is.ID)
+	}
+
+	for _, reverse := range []bool{false, true} {
+		filter := issues.ListFilter{ProjectPrefix: "cat", Sort: issues.SortID, Reverse: reverse, Limit: 5}
+		var seen []string
+		pages := 0
+		for {
+			page, next, err := svc.ListIssues(ctx, filter)
+			if err != nil {
+				t.Fatalf("list page %d: %v", pages, err)
+			}
+			pages++
+			for _, is := range page {
+				seen = append(seen, is.ID)
+			}
+			if next == "" {
+				break
+			}
+			filter.Cursor = next
+		}
+		if pages != 3 {
+			t.Fatalf("reverse=%v: expected 3 pages, got %d", reverse, pages)
+		}
+		want := append([]string(nil), created...)
+		if reverse {
+			for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+				want[i], want[j] = want[j], want[i]
+			}
+		}
+		if strings.Join(seen, ",") != strings.Join(want, ",") {
+			t.Fatalf("reverse=%v: expected %v, got %v", reverse, want, seen)
+		}
+	}
+
+	_, next, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat", Limit: 5})
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if _, _, err := svc.ListIssues(ctx, issues.ListFilter{ProjectPrefix: "cat", Sort: issues.SortTitle, Cursor: next}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for cursor with different sort, got %v", err)
+	}
+	if _, _, err := svc.ListIssues(ctx, issues.ListFilter{Cursor: "not-a-cursor"}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for malformed cursor, got %v", err)
+	}
+}
+
+func TestSearchIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	inTitle, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Rate limiting", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create title match: %v", err)
+	}
+	inBody, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Gateway", "Add rate limiting to the gateway", nil, nil)
+	if err != nil {
+		t.Fatalf("create body match: %v", err)
+	}
+	inComment, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Billing", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create comment match: %v", err)
+	}
+	if _, err := svc.AddComment(ctx, inComment.ID, "needs rate limiting too"); err != nil {
+		t.Fatalf("add comment: %v", err)
+	}
+
+	results, err := svc.Search(ctx, "rate limit*", issues.ListFilter{})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Issue.ID)
+	}
+	want := []string{inTitle.ID, inBody.ID, inComment.ID}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected ranking %v, got %v", want, got)
+	}
+	if !strings.Contains(results[1].Snippet, "[rate]") {
+		t.Fatalf("expected highlighted snippet, got %q", results[1].Snippet)
+	}
+
+	newTitle := "Gateway routing"
+	newBody := "No more throttling here"
+	if _, err := svc.UpdateIssue(ctx, inBody.ID, &newTitle, &newBody, nil); err != nil {
+		t.Fatalf("update issue: %v", err)
+	}
+	if _, err := svc.TransitionState(ctx, inComment.ID, issues.StateCanceled, "", nil); err != nil {
+		t.Fatalf("cancel issue: %v", err)
+	}
+	results, err = svc.Search(ctx, "rate", issues.ListFilter{States: []issues.State{issues.StateTodo}})
+	if err != nil {
+		t.Fatalf("search after edits: %v", err)
+	}
+	if len(results) != 1 || results[0].Issue.ID != inTitle.ID {
+		t.Fatalf("expected only the title match after edits, got %+v", results)
+	}
+
+	if _, err := svc.Search(ctx, `"unbalanced AND (`, issues.ListFilter{}); err != nil {
+		t.Fatalf("search input should never be a syntax error: %v", err)
+	}
+	if _, err := svc.Search(ctx, "  ", issues.ListFilter{}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for empty query, got %v", err)
+	}
+}
+
+func TestListQueryIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t).WithActor("agent-a")
+
+	root, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Platform", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Backend", "", &root.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	alpha, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Rate limit API", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create alpha: %v", err)
+	}
+	beta, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Beta", "", &ws.ID, []string{alpha.ID})
+	if err != nil {
+		t.Fatalf("create beta: %v", err)
+	}
+	if _, err := svc.AssignIssue(ctx, alpha.ID, "agent-a", nil); err != nil {
+		t.Fatalf("assign alpha: %v", err)
+	}
+	if _, err := svc.AddLabels(ctx, beta.ID, []string{"bug", "area:api"}); err != nil {
+		t.Fatalf("label beta: %v", err)
+	}
+
+	ids := func(list []issues.Issue) string {
+		out := make([]string, 0, len(list))
+		for _, is := range list {
+			out = append(out, is.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"state:todo category:task parent:" + ws.ID + " updated>7d blocked:false", alpha.ID},
+		{"category:t blocked:true", beta.ID},
+		{"category=w,p", root.ID + "," + ws.ID},
+		{"parent:none", root.ID},
+		{"assignee:me", alpha.ID},
+		{"category:task assignee!=me", beta.ID},
+		{"label:bug", beta.ID},
+		{"category:task label!=bug", alpha.ID},
+		{"under:" + root.ID + " RATE", alpha.ID},
+		{`title:"limit api"`, alpha.ID},
+		{`title:"limit \"api"`, ""},
+		{`label:"area:api",ops`, beta.ID},
+		{`category:task created>"2000-01-01"`, alpha.ID + "," + beta.ID},
+		{"created<2000-01-01", ""},
+		{"archived:true", ""},
+	}
+	for _, tc := range cases {
+		got, _, err := svc.ListIssues(ctx, issues.ListFilter{Query: tc.query})
+		if err != nil {
+			t.Fatalf("%q: list: %v", tc.query, err)
+		}
+		if ids(got) != tc.want {
+			t.Fatalf("%q: expected %q, got %q", tc.query, tc.want, ids(got))
+		}
+	}
+
+	combined, _, err := svc.ListIssues(ctx, issues.ListFilter{Query: "category:task", States: []issues.State{issues.StateTodo}, Assignee: "agent-a"})
+	if err != nil {
+		t.Fatalf("combined filter: %v", err)
+	}
+	if ids(combined) != alpha.ID {
+		t.Fatalf("expected query and fields to combine, got %q", ids(combined))
+	}
+
+	errCases := []struct {
+		query string
+		want  string
+	}{
+		{"state:todo colour:red", `"colour:red" at column 12: unknown field "colour"`},
+		{"state:doing", `"state:doing" at column 1: unknown state "doing"`},
+		{"updated:7d", `updated compares with < <= > >=`},
+		{"updated>yesterday", `invalid time "yesterday"`},
+		{"state!", `unknown operator`},
+		{`title:"open`, `unterminated quote at column 7`},
+		{`title:"open\"`, `unterminated quote at column 7`},
+		{`label:"bug"x`, `quotes must enclose the whole value`},
+		{"blocked:maybe", `expected true or false`},
+	}
+	for _, tc := range errCases {
+		_, _, err := svc.ListIssues(ctx, issues.ListFilter{Query: tc.query})
+		if !errors.Is(err, issues.ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: expected invalid input containing %q, got %v", tc.query, tc.want, err)
+		}
+	}
+	if _, _, err := newTestService(t).ListIssues(ctx, issues.ListFilter{Query: "assignee:me"}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for me without actor, got %v", err)
+	}
+}
+
+func TestSavedViewsIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+	agentA := svc.WithActor("agent-a")
+	agentB := svc.WithActor("agent-b")
+
+	first, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "First", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create first: %v", err)
+	}
+	second, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Second", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create second: %v", err)
+	}
+	if _, err := svc.AssignIssue(ctx, first.ID, "agent-a", nil); err != nil {
+		t.Fatalf("assign first: %v", err)
+	}
+	if _, err := svc.AssignIssue(ctx, second.ID, "agent-b", nil); err != nil {
+		t.Fatalf("assign second: %v", err)
+	}
+
+	saved, err := agentA.SaveView(ctx, issues.View{Name: "Mine", Query: "assignee:me state:todo"})
+	if err != nil {
+		t.Fatalf("save view: %v", err)
+	}
+	if saved.Name != "mine" || saved.CreatedBy != "agent-a" {
+		t.Fatalf("unexpected saved view: %+v", saved)
+	}
+
+	for _, tc := range []struct {
+		svc  *issues.Service
+		want string
+	}{{agentA, first.ID}, {agentB, second.ID}} {
+		view, err := tc.svc.GetView(ctx, "mine")
+		if err != nil {
+			t.Fatalf("get view: %v", err)
+		}
+		list, _, err := tc.svc.ListIssues(ctx, view.Filter())
+		if err != nil {
+			t.Fatalf("run view as %s: %v", tc.svc.Actor(), err)
+		}
+		if len(list) != 1 || list[0].ID != tc.want {
+			t.Fatalf("run view as %s: expected %s, got %+v", tc.svc.Actor(), tc.want, list)
+		}
+	}
+
+	if _, err := agentB.SaveView(ctx, issues.View{Name: "mine", Query: "state:todo", Sort: issues.SortTitle, Reverse: true}); err != nil {
+		t.Fatalf("replace view: %v", err)
+	}
+	if _, err := svc.SaveView(ctx, issues.View{Name: "other", ProjectPrefix: "cat"}); err != nil {
+		t.Fatalf("save second view: %v", err)
+	}
+	views, err := svc.ListViews(ctx)
+	if err != nil {
+		t.Fatalf("list views: %v", err)
+	}
+	if len(views) != 2 || views[0].Name != "mine" || views[0].Sort != issues.SortTitle || views[0].CreatedBy != "agent-a" {
+		t.Fatalf("unexpected views: %+v", views)
+	}
+
+	if _, err := svc.SaveView(ctx, issues.View{Name: "bad", Query: "colour:red"}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for bad query, got %v", err)
+	}
+	if _, err := svc.SaveView(ctx, issues.View{Name: "no spaces"}); !errors.Is(err, issues.ErrInvalidInput) {
+		t.Fatalf("expected invalid input for bad name, got %v", err)
+	}
+	if err := svc.DeleteView(ctx, "other"); err != nil {
+		t.Fatalf("delete view: %v", err)
+	}
+	if _, err := svc.GetView(ctx, "other"); !errors.Is(err, issues.ErrNotFound) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
+
+func TestStructuredErrorsIntegration(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(t)
+
+	a, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "A", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create a: %v", err)
+	}
+	b, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "B", "", nil, []string{a.ID})
+	if err != nil {
+		t.Fatalf("create b: %v", err)
+	}
+	title := "A renamed"
+	if _, err := svc.UpdateIssue(ctx, a.ID, &title, nil, nil); err != nil {
+		t.Fatalf("rename a: %v", err)
+	}
+
+	var detail *issues.Error
+	stale := int64(1)
+	_, err = svc.TransitionState(ctx, a.ID, issues.StateInProgress, "", &stale)
+	if !errors.As(err, &detail) || !errors.Is(err, issues.ErrConflict) {
+		t.Fatalf("expected structured conflict, got %v", err)
+	}
+	if detail.ExpectedVersion == nil || *detail.ExpectedVersion != 1 || detail.CurrentVersion == nil || *detail.CurrentVersion != 2 {
+		t.Fatalf("expected versions 1/2 on stale write, got %+v", detail)
+	}
+	if err.Error() != "conflict: stale write; expected version 1" || issues.ErrorCode(err) != "conflict" {
+		t.Fatalf("unexpected message or code: %q %q", err.Error(), issues.ErrorCode(err))
+	}
+
+	_, err = svc.TransitionState(ctx, b.ID, issues.StateInProgress, "", nil)
+	if !errors.As(err, &detail) || detail.Field != "blocked_by" || strings.Join(detail.IDs, ",") != a.ID {
+		t.Fatalf("expected unresolved blocked_by detail, got %v (%+v)", err, detail)
+	}
+
+	_, err = svc.SetBlockedBy(ctx, a.ID, []string{b.ID}, nil)
+	if !errors.As(err, &detail) || issues.ErrorCode(err) != "cycle_detected" || strings.Join(detail.IDs, ",") != a.ID+","+b.ID+","+a.ID {
+		t.Fatalf("expected cycle path detail, got %v (%+v)", err, detail)
+	}
+
+	_, err = svc.GetIssue(ctx, "cat-999")
+	if !errors.As(err, &detail) || issues.ErrorCode(err) != "not_found" || strings.Join(detail.IDs, ",") != "cat-999" {
+		t.Fatalf("expected not found detail, got %v (%+v)", err, detail)
+	}
+
+	_, err = svc.CreateIssue(ctx, "cat", issues.CategoryProject, " ", "", nil, nil)
+	if !errors.As(err, &detail) || detail.Field != "title" || issues.ErrorCode(err) != "invalid_input" {
+		t.Fatalf("expected invalid title detail, got %v (%+v)", err, detail)
+	}
+
+	if code := issues.ErrorCode(errors.New("disk full")); code != "internal" {
+		t.Fatalf("expected internal code for unknown error, got %q", code)
+	}
+}
+
+func TestDoctorIntegration(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.Open(ctx, filepath.Join(t.TempDir(), "issues.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+	svc := issues.NewService(database)
+
+	project, err := svc.CreateIssue(ctx, "cat", issues.CategoryProject, "Project", "", nil, nil)
+	if err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	ws, err := svc.CreateIssue(ctx, "cat", issues.CategoryWorkstream, "Workstream", "", &project.ID, nil)
+	if err != nil {
+		t.Fatalf("create workstream: %v", err)
+	}
+	task, err := svc.CreateIssue(ctx, "cat", issues.CategoryTask, "Task", "", &ws.ID, nil)
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+
+	problems, err := svc.Doctor(ctx, false)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("expected a clean database, got %+v, %v", problems, err)
+	}
+
+	// Break the invariants behind the service's back.
+	if _, err := svc.CreateIssue(ctx, "dog", issues.CategoryProject, "Other", "", nil, nil); err != nil {
+		t.Fatalf("create other project: %v", err)
+	}
+	if _, err := svc.SetBlockedBy(ctx, task.ID, []string{ws.ID}, nil); err != nil {
+		t.Fatalf("set blocked_by: %v", err)
+	}
+	task, err = svc.GetIssue(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO issue_dependencies(issue_id, depends_on_id, position) VALUES ('cat-3', 'dog-1', 1)`,
+		`UPDATE issues SET closed_at = CURRENT_TIMESTAMP WHERE id = 'cat-2'`,
+		`UPDATE issues SET parent_id = 'cat-2' WHERE id = 'cat-1'`,
+		`INSERT INTO issues(id, category, title, state) VALUES ('cat-4', 'task', 'Orphan', 'todo')`,
+		`INSERT INTO issues(id, category, title, state, parent_id) VALUES
+			('cat-5', 'task', 'Loop a', 'todo', 'cat-2'),
+			('cat-6', 'task', 'Loop b', 'todo', 'cat-2')`,
+		`INSERT INTO issue_dependencies(issue_id, depends_on_id) VALUES ('cat-5', 'cat-6'), ('cat-6', 'cat-5')`,
+	} {
+		if _, err := database.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("corrupt: %v", err)
+		}
+	}
+
+	summarize := func(problems []issues.Problem) string {
+		var parts []string
+		for _, p := range problems {
+			part := p.Check + ":" + p.IssueID
+			if p.Fixed {
+				part += ":fixed"
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	problems, err = svc.Doctor(ctx, false)
+	if err != nil {
+		t.Fatalf("doctor: %v", err)
+	}
+	want := "invalid_parent:cat-1,closed_at:cat-2,invalid_blocked_by:cat-3,orphaned:cat-4,blocked_by_cycle:cat-5"
+	if got := summarize(problems); got != want {
+		t.Fatalf("unexpected problems:\n got %s\nwant %s", got, want)
+	}
+	if got, err := svc.GetIssue(ctx, task.ID); err != nil || got.Version != task.Version {
+		t.Fatalf("doctor without fix must not change issues: %+v, %v", got, err)
+	}
+
+	problems, err = svc.Doctor(ctx, true)
+	if err != nil {
+		t.Fatalf("doctor --fix: %v", err)
+	}
+	want = "invalid_parent:cat-1:fixed,closed_at:cat-2:fixed,invalid_blocked_by:cat-3:fixed,orphaned:cat-4,blocked_by_cycle:cat-5"
+	if got := summarize(problems); got != want {
+		t.Fatalf("unexpected problems after fix:\n got %s\nwant %s", got, want)
+	}
+
+	fixed, err := svc.GetIssue(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if strings.Join(fixed.BlockedBy, ",") != ws.ID || fixed.Version != task.Version+1 {
+		t.Fatalf("expected blocked_by [%s] at version %d, got %v at %d", ws.ID, task.Version+1, fixed.BlockedBy, fixed.Version)
+	}
+	events, err := svc.History(ctx, task.ID)
+	if err != nil || events[len(events)-1].Kind != issues.EventBlockedBy {
+		t.Fatalf("expected a blocked_by event for the repair, got %+v, %v", events, err)
+	}
+	if got, err := svc.GetIssue(ctx, ws.ID); err != nil || got.ClosedAt != nil {
+		t.Fatalf("expected closed_at cleared, got %+v, %v", got, err)
+	}
+
+	problems, err = svc.Doctor(ctx, true)
+	if err != nil {
+		t.Fatalf("doctor again: %v", err)
+	}
+	if got := summarize(problems); got != "orphaned:cat-4,blocked_by_cycle:cat-5" {
+		t.Fatalf("expected only unfixable problems left, got %s", got)
+	}
 }
@@ -40,7 +40,7 @@ func ValidateTransition(from, to State) error {
 	}
 	next, ok := validTransitions[from]
 	if !ok || !next[to] {
-		return fmt.Errorf("%w: %s -> %s", ErrInvalidStateTransition, from, to)
+		return &Error{Kind: ErrInvalidStateTransition, Message: fmt.Sprintf("%s -> %s", from, to), Field: "state"}
 	}
 	return nil
 }
@@ -21,21 +21,134 @@ const (
 )
 
 type Issue struct {
-	ID            string     `json:"id"`
-	ProjectPrefix string     `json:"project_prefix"`
-	Category      Category   `json:"category"`
-	Title         string     `json:"title"`
-	Body          string     `json:"body"`
-	State         State      `json:"state"`
-	ParentID      *string    `json:"parent_id,omitempty"`
-	Version       int64      `json:"version"`
-	BlockedBy     []string   `json:"blocked_by"`
+	ID            string   `json:"id"`
+	ProjectPrefix string   `json:"project_prefix"`
+	Category      Category `json:"category"`
+	Title         string   `json:"title"`
+	Body          string   `json:"body"`
+	State         State    `json:"state"`
+	ParentID      *string  `json:"parent_id,omitempty"`
+	Assignee      *string  `json:"assignee,omitempty"`
+	Version       int64    `json:"version"`
+	BlockedBy     []string `json:"blocked_by"`
+	// Blocks lists the issues whose blocked_by includes this one.
+	Blocks        []string   `json:"blocks"`
+	BlockedReason *string    `json:"blocked_reason,omitempty"`
+	Labels        []string   `json:"labels"`
 	CreatedAt     time.Time  `json:"created_at"`
 	LastUpdatedAt time.Time  `json:"last_updated_at"`
 	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	Comments      []Comment  `json:"comments,omitempty"`
+}
+
+type Comment struct {
+	ID        int64     `json:"id"`
+	IssueID   string    `json:"issue_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SearchResult struct {
+	Issue   Issue   `json:"issue"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
 }
 
 type TreeNode struct {
 	Issue    Issue      `json:"issue"`
 	Children []TreeNode `json:"children"`
 }
+
+type SortField string
+
+const (
+	SortCreated SortField = "created"
+	SortUpdated SortField = "updated"
+	SortClosed  SortField = "closed"
+	SortID      SortField = "id"
+	SortTitle   SortField = "title"
+	SortState   SortField = "state"
+)
+
+// ListFilter narrows ListIssues. Zero values mean "no constraint", except
+// that archived issues are skipped unless IncludeArchived is set.
+type ListFilter struct {
+	ProjectPrefix string
+	States        []State
+	Categories    []Category
+	ParentID      string // direct children of this issue
+	AncestorID    string // descendants of this issue at any depth
+	Assignee      string
+	AnyLabels     []string // match issues carrying at least one of these
+	AllLabels     []string // match issues carrying every one of these
+
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	ClosedAfter   *time.Time
+	ClosedBefore  *time.Time
+
+	// HasUnresolvedDeps keeps only issues with (true) or without (false)
+	// blocked_by entries that are not done.
+	HasUnresolvedDeps *bool
+
+	IncludeArchived bool
+
+	// Query is an expression in the query language (see compileQuery),
+	// combined with the fields above. A query that filters on archived
+	// overrides IncludeArchived.
+	Query string
+
+	Sort    SortField // defaults to SortCreated
+	Reverse bool
+
+	// Limit caps the page size; zero returns every match. Cursor resumes
+	// after the last issue of a previous page and must be used with the
+	// same filter and sort.
+	Limit  int
+	Cursor string
+}
+
+// View is a named, shared issue selection. Query is stored unevaluated so
+// that "me" and relative times resolve when the view is run.
+type View struct {
+	Name            string    `json:"name"`
+	ProjectPrefix   string    `json:"project_prefix,omitempty"`
+	Query           string    `json:"query"`
+	Sort            SortField `json:"sort,omitempty"`
+	Reverse         bool      `json:"reverse,omitempty"`
+	IncludeArchived bool      `json:"include_archived,omitempty"`
+	CreatedBy       string    `json:"created_by,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type EventKind string
+
+const (
+	EventCreate    EventKind = "create"
+	EventState     EventKind = "state"
+	EventParent    EventKind = "parent"
+	EventBlockedBy EventKind = "blocked_by"
+	EventTitle     EventKind = "title"
+	EventBody      EventKind = "body"
+	EventArchive   EventKind = "archive"
+	EventDelete    EventKind = "delete"
+	EventAssignee  EventKind = "assignee"
+	EventLabels    EventKind = "labels"
+	EventRepair    EventKind = "repair"
+)
+
+type Event struct {
+	ID        int64     `json:"id"`
+	IssueID   string    `json:"issue_id"`
+	Kind      EventKind `json:"kind"`
+	OldValue  *string   `json:"old_value,omitempty"`
+	NewValue  *string   `json:"new_value,omitempty"`
+	Version   int64     `json:"version"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
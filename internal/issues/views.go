@@ -0,0 +1,131 @@
+package issues
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var viewNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+const viewSelectColumns = "name, project_prefix, query, sort, reverse, include_archived, created_by, created_at, updated_at"
+
+// SaveView creates or replaces the named view. The query is checked for
+// syntax but stored as written.
+func (s *Service) SaveView(ctx context.Context, v View) (*View, error) {
+	v.Name = strings.ToLower(strings.TrimSpace(v.Name))
+	if !viewNameRe.MatchString(v.Name) {
+		return nil, invalidField("name", "invalid view name %q (use lowercase letters, digits, '.', '_' or '-', up to 50 chars)", v.Name)
+	}
+	v.ProjectPrefix = strings.ToLower(strings.TrimSpace(v.ProjectPrefix))
+	if v.ProjectPrefix != "" && !projectPrefixRe.MatchString(v.ProjectPrefix) {
+		return nil, invalidField("project", "project prefix must be exactly 3 lowercase alphanumeric characters")
+	}
+	v.Query = strings.TrimSpace(v.Query)
+	// Any non-empty actor will do; "me" is resolved when the view runs.
+	if _, err := compileQuery(v.Query, time.Now(), "me"); err != nil {
+		return nil, err
+	}
+	if v.Sort != "" && !IsValidSortField(v.Sort) {
+		return nil, invalidField("sort", "unknown sort field %q (use created|updated|closed|id|title|state)", v.Sort)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO saved_views(name, project_prefix, query, sort, reverse, include_archived, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			project_prefix = excluded.project_prefix,
+			query = excluded.query,
+			sort = excluded.sort,
+			reverse = excluded.reverse,
+			include_archived = excluded.include_archived,
+			updated_at = CURRENT_TIMESTAMP
+	`, v.Name, v.ProjectPrefix, v.Query, string(v.Sort), v.Reverse, v.IncludeArchived, s.actor)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetView(ctx, v.Name)
+}
+
+func (s *Service) GetView(ctx context.Context, name string) (*View, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil, invalidField("name", "view name is required")
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+viewSelectColumns+` FROM saved_views WHERE name = ?`, name)
+	v, err := scanView(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: view %q not found", ErrNotFound, name)
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ListViews returns every saved view ordered by name.
+func (s *Service) ListViews(ctx context.Context) ([]View, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+viewSelectColumns+` FROM saved_views ORDER BY name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]View, 0)
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Service) DeleteView(ctx context.Context, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	res, err := s.db.ExecContext(ctx, `DELETE FROM saved_views WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return fmt.Errorf("%w: view %q not found", ErrNotFound, name)
+	}
+	return nil
+}
+
+// Filter returns the list filter the view selects.
+func (v View) Filter() ListFilter {
+	return ListFilter{
+		ProjectPrefix:   v.ProjectPrefix,
+		Query:           v.Query,
+		Sort:            v.Sort,
+		Reverse:         v.Reverse,
+		IncludeArchived: v.IncludeArchived,
+	}
+}
+
+func scanView(row scanner) (View, error) {
+	var v View
+	var sortField, created, updated string
+	if err := row.Scan(&v.Name, &v.ProjectPrefix, &v.Query, &sortField, &v.Reverse, &v.IncludeArchived, &v.CreatedBy, &created, &updated); err != nil {
+		return View{}, err
+	}
+	v.Sort = SortField(sortField)
+	var err error
+	if v.CreatedAt, err = parseSQLiteTime(created); err != nil {
+		return View{}, err
+	}
+	if v.UpdatedAt, err = parseSQLiteTime(updated); err != nil {
+		return View{}, err
+	}
+	return v, nil
+}